@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/index"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+)
+
+// indexCommand runs "mygrep index SUBCOMMAND ..." and returns the exit
+// status.
+func indexCommand(args []string) int {
+	fs := flag.NewFlagSet("mygrep index", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mygrep index build <dir>\n")
+		fmt.Fprintf(os.Stderr, "       mygrep index update <dir>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	var err error
+	switch fs.Arg(0) {
+	case "build":
+		err = index.Build(fs.Arg(1))
+	case "update":
+		var st index.Stats
+		if st, err = index.Update(fs.Arg(1)); err == nil {
+			fmt.Printf("%d added, %d changed, %d removed\n", st.Added, st.Changed, st.Removed)
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// indexedFiles returns the files under the indexed roots that may match
+// patterns.
+func indexedFiles(roots, patterns []string, opts matcher.Options, reportError func(string, error)) ([]string, error) {
+	re, err := matcher.ParsePatterns(patterns, opts)
+	if err != nil {
+		return nil, err
+	}
+	q := index.RegexpQuery(re)
+	var files []string
+	for _, root := range roots {
+		ix, err := index.Open(root)
+		if err != nil {
+			reportError(root, err)
+			continue
+		}
+		files = append(files, ix.Files(q)...)
+	}
+	return files, nil
+}
@@ -3,44 +3,480 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"go/token"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	grepio "github.com/codecrafters-io/grep-starter-go/internal/io"
+	"github.com/codecrafters-io/grep-starter-go/internal/lang"
 	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/search"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
 )
 
 func main() {
-    if len(os.Args) < 3 || os.Args[1] != "-E" {
-        fmt.Fprintf(os.Stderr, "usage: mygrep -E <pattern>\n")
-        os.Exit(2)
-    }
-
-    pattern := os.Args[2]
-    
-    scanner := bufio.NewScanner(os.Stdin)
-
-    regexMatcher, err := matcher.NewRegexMatcher(pattern)
-    if err != nil {
-        fmt.Fprintf(os.Stderr, "error compiling regex: %v\n", err)
-        os.Exit(1)
-    }
-    matchFound := false
-
-    for scanner.Scan() {
-        line := scanner.Text()
-        if regexMatcher.Match([]byte(line), line) {
-            matchFound = true
-            break
-        }
-    }
-
-    if err := scanner.Err(); err != nil {
-        fmt.Fprintf(os.Stderr, "error reading input: %v\n", err)
-        os.Exit(1)
-    }
-
-    if !matchFound {
-        os.Exit(1)
-    } else {
-        os.Exit(0)
-    }
-}
\ No newline at end of file
+	extended := flag.Bool("E", false, "interpret PATTERN as an extended regular expression")
+	ascii := flag.Bool("ascii", false, `restrict \d, \w, \s, \b and \B to ASCII, like a leading (?a)`)
+	var searchZip bool
+	flag.BoolVar(&searchZip, "z", false, "search the decompressed content of gzip, bzip2, zlib and .Z files, and the members of tar and zip archives; without -z, archives are searched as plain files")
+	flag.BoolVar(&searchZip, "search-zip", false, "same as -z")
+	zmax := flag.Int("zmax", 1, "with -z, open tar and zip archives nested up to `NUM` levels deep; archives are not opened without -z")
+	maxMemberSize := flag.Int64("max-member-size", search.DefaultMaxMemberSize, "skip archive members, and zips read from pipes or other archives, larger than `BYTES`")
+	lineNumber := flag.Bool("n", false, "prefix each line of output with its line number")
+	byteOffset := flag.Bool("b", false, "prefix each line of output with its byte offset in the input")
+	encoding := flag.String("encoding", "auto", "text encoding of the input: `NAME` auto, utf-8, utf-16le, utf-16be or latin1")
+	noMmap := flag.Bool("no-mmap", false, "never memory-map input files")
+	binaryFiles := flag.String("binary-files", "binary", "how to treat binary files: `TYPE` binary, text or without-match")
+	binaryText := flag.Bool("a", false, "process binary files as text, same as --binary-files=text")
+	binaryIgnore := flag.Bool("I", false, "assume binary files do not match, same as --binary-files=without-match")
+	quiet := flag.Bool("q", false, "print nothing and exit 0 as soon as a match is found")
+	maxCount := flag.Int("m", 0, "stop reading a file after `NUM` matching lines; 0 means no limit")
+	filesWithMatches := flag.Bool("l", false, "print only the names of files with a match")
+	jsonOutput := flag.Bool("json", false, "print JSON Lines events for each file's matches and context lines, and a final summary")
+	vimgrep := flag.Bool("vimgrep", false, "print path:line:col:text for each match, as vim's grepformat expects, so a line with several matches is printed several times; context options are ignored")
+	hyperlinkFormat := flag.String("hyperlink-format", "", "make file names OSC 8 terminal hyperlinks to the URL `TEMPLATE`, with fields {host}, {path}, {line} and {col}; default is "+search.DefaultHyperlink)
+	outputFormat := flag.String("format", "", "print results as `FORMAT`: sarif, a SARIF log with a result for each match of each pattern, or a template such as '{path}:{line}:{col}: {match}' with fields path, line, col, offset, text, match, count, matches, groups {N} and {<NAME>}, escapes \\t \\n \\\\ \\{ \\}, and {if context}...{else}...{end}")
+	afterContext := flag.Int("A", 0, "print `NUM` lines of trailing context after matching lines")
+	beforeContext := flag.Int("B", 0, "print `NUM` lines of leading context before matching lines")
+	contextLines := flag.Int("C", 0, "print `NUM` lines of context around matching lines, same as -A NUM -B NUM")
+	recursive := flag.Bool("r", false, "search directories recursively")
+	language := flag.String("lang", "", "treat inputs as source code in `LANG`: c, go, python, shell, sql or yaml; with -r, search only its files")
+	ident := flag.String("ident", "", "instead of a pattern, find the identifiers declaring or referring to the Go object named `NAME`: the package-level one, the only one, or with NAME:LINE the one on that line; methods count as funcs, and selections x.NAME and names the file does not declare are included when --kind allows vars or funcs")
+	identKind := flag.String("kind", "", "with --ident, only objects of `KINDS`: func, type, var or const, separated by |")
+	only := flag.String("only", "", "match only within `KINDS` of source regions: a comma-separated list of comments, strings, code, and for Go idents and imports; the language is found from each file's extension unless --lang is given")
+	var threads int
+	flag.IntVar(&threads, "j", 0, "search up to `NUM` files at once (default one per CPU)")
+	flag.IntVar(&threads, "threads", 0, "same as -j `NUM`")
+	unordered := flag.Bool("unordered", false, "print each file's results as soon as it is searched instead of in path order")
+	var patternFiles stringList
+	flag.Var(&patternFiles, "f", "read patterns from `FILE`, one per line, instead of the command line; may be repeated; a line \"# id: NAME\" names the rule of the next pattern for --format sarif")
+	cacheDir := flag.String("cache-dir", os.Getenv("MYGREP_CACHE_DIR"), "keep compiled patterns in `DIR` and reuse them on later runs (default $MYGREP_CACHE_DIR)")
+	maxSteps := flag.Int("max-steps", 0, "give up on a line after `NUM` VM instructions; 0 means no limit")
+	maxStack := flag.Int("max-stack", 0, "give up on a line once `NUM` alternatives are pending; 0 means no limit")
+	dumpProgram := flag.Bool("dump-program", false, "print the compiled VM program for the pattern and exit")
+	useIndex := flag.Bool("index", false, "treat each path as a directory indexed by mygrep index build, and search only the files its index finds may match")
+	traceMatch := flag.Bool("trace-match", false, "print each VM step of matching the pattern against one line and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mygrep [options] -E <pattern> [file...]\n")
+		fmt.Fprintf(os.Stderr, "       mygrep [options] -E -f <pattern file> [file...]\n")
+		fmt.Fprintf(os.Stderr, "       mygrep [options] --ident <name>[:<line>] [--kind <kinds>] [file...]\n")
+		fmt.Fprintf(os.Stderr, "       mygrep --index [options] -E <pattern> [dir...]\n")
+		fmt.Fprintf(os.Stderr, "       mygrep index build|update <dir>\n")
+		fmt.Fprintf(os.Stderr, "       mygrep --dump-program <pattern>\n")
+		fmt.Fprintf(os.Stderr, "       mygrep --trace-match <pattern> <line>\n")
+		flag.PrintDefaults()
+	}
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		os.Exit(indexCommand(os.Args[2:]))
+	}
+	flag.Parse()
+
+	if *dumpProgram && flag.NArg() == 1 {
+		listing, err := matcher.DumpProgram(flag.Arg(0), matcher.Options{ASCII: *ascii})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error compiling regex: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(listing)
+		os.Exit(0)
+	}
+	if *traceMatch && flag.NArg() == 2 {
+		out := bufio.NewWriter(os.Stdout)
+		matched, err := matcher.TraceMatch(flag.Arg(0), []byte(flag.Arg(1)), matcher.Options{ASCII: *ascii}, out)
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+		if !matched {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *ident == "" && (!*extended || (len(patternFiles) == 0 && flag.NArg() < 1)) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var patterns, ruleIDs, files []string
+	var identName string
+	var identLine int
+	if *ident != "" {
+		// The regions are the identifiers; any match within one is a hit.
+		name, at, found := strings.Cut(*ident, ":")
+		line, err := strconv.Atoi(at)
+		if !token.IsIdentifier(name) || found && (err != nil || line < 1) {
+			fmt.Fprintf(os.Stderr, "mygrep: --ident %q is not a Go identifier, optionally followed by :LINE\n", *ident)
+			os.Exit(2)
+		}
+		identName, identLine = name, line
+		patterns, files = []string{name}, flag.Args()
+	} else if len(patternFiles) > 0 {
+		var err error
+		if patterns, ruleIDs, err = readPatterns(patternFiles); err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+		files = flag.Args()
+	} else {
+		patterns, files = flag.Args()[:1], flag.Args()[1:]
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+		if *useIndex {
+			files = []string{"."}
+		}
+	}
+
+	binaryMode, err := search.ParseBinaryMode(*binaryFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+		os.Exit(2)
+	}
+	switch {
+	case *binaryText:
+		binaryMode = search.BinaryText
+	case *binaryIgnore:
+		binaryMode = search.BinaryWithoutMatch
+	}
+
+	var regions func(string, []byte) ([]lang.Span, error)
+	if *language != "" && !slices.Contains(lang.Languages, *language) {
+		fmt.Fprintf(os.Stderr, "mygrep: unsupported language %q\n", *language)
+		os.Exit(2)
+	}
+	if *ident != "" {
+		kinds, err := lang.ParseObjKinds(*identKind)
+		switch {
+		case err != nil:
+		case *only != "":
+			err = fmt.Errorf("--only cannot be used with --ident")
+		case *language != "" && *language != "go":
+			err = fmt.Errorf("--ident needs --lang go")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+		*language = "go"
+		var mu sync.Mutex
+		regions = func(name string, src []byte) ([]lang.Span, error) {
+			spans, err := lang.IdentRegions(src, identName, identLine, kinds)
+			n := 0
+			for _, sp := range spans {
+				if sp.Kind == lang.Unresolved {
+					n++
+				}
+			}
+			if n > 0 {
+				mu.Lock()
+				fmt.Fprintf(os.Stderr, "mygrep: %s: unresolved references to %s, included: %d\n", name, identName, n)
+				mu.Unlock()
+			}
+			return spans, err
+		}
+	} else if *only != "" {
+		kinds, err := lang.ParseKinds(*only)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+		regions = func(name string, src []byte) ([]lang.Span, error) {
+			language := *language
+			if language == "" {
+				language = lang.Detect(name)
+			}
+			if language == "" {
+				// Nothing is known of the file's syntax, so nothing matches.
+				return nil, nil
+			}
+			return lang.Regions(language, src, kinds)
+		}
+	}
+
+	inputEncoding, err := grepio.ParseEncoding(*encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+		os.Exit(2)
+	}
+	format := search.FormatText
+	switch *outputFormat {
+	case "":
+	case "sarif":
+		format = search.FormatSARIF
+	default:
+		if !strings.Contains(*outputFormat, "{") {
+			fmt.Fprintf(os.Stderr, "mygrep: unknown --format %q\n", *outputFormat)
+			os.Exit(2)
+		}
+		format = search.FormatTemplate
+	}
+	if *vimgrep {
+		if format != search.FormatText {
+			fmt.Fprintf(os.Stderr, "mygrep: --vimgrep cannot be used with --format\n")
+			os.Exit(2)
+		}
+		format, *outputFormat = search.FormatTemplate, vimgrepTemplate
+	}
+	if *jsonOutput {
+		if format != search.FormatText {
+			fmt.Fprintf(os.Stderr, "mygrep: --json cannot be used with --format or --vimgrep\n")
+			os.Exit(2)
+		}
+		format = search.FormatJSON
+	}
+	if format != search.FormatText && *filesWithMatches {
+		fmt.Fprintf(os.Stderr, "mygrep: -l cannot be used with --json, --format or --vimgrep\n")
+		os.Exit(2)
+	}
+	var hyperlink *search.Hyperlink
+	if *hyperlinkFormat != "" {
+		if format != search.FormatText {
+			fmt.Fprintf(os.Stderr, "mygrep: --hyperlink-format cannot be used with --json, --format or --vimgrep\n")
+			os.Exit(2)
+		}
+		if *hyperlinkFormat == "default" {
+			*hyperlinkFormat = search.DefaultHyperlink
+		}
+		if hyperlink, err = search.ParseHyperlink(*hyperlinkFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *useIndex {
+		// The index holds the trigrams of the bytes on disk.
+		switch {
+		case searchZip:
+			err = fmt.Errorf("--index cannot be used with -z")
+		case *encoding != "auto" && *encoding != "utf-8":
+			err = fmt.Errorf("--index cannot be used with --encoding %s", *encoding)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if len(patterns) == 0 {
+		// An empty pattern file matches nothing.
+		os.Exit(1)
+	}
+	matchOpts := matcher.Options{
+		ASCII:    *ascii,
+		CacheDir: *cacheDir,
+		Limits:   pkg.Limits{MaxSteps: max(*maxSteps, 0), MaxStack: max(*maxStack, 0)},
+	}
+	regexMatcher, err := matcher.NewRegexMatcherPatterns(patterns, matchOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error compiling regex: %v\n", err)
+		os.Exit(1)
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["A"] {
+		*afterContext = *contextLines
+	}
+	if !set["B"] {
+		*beforeContext = *contextLines
+	}
+	if *vimgrep {
+		*afterContext, *beforeContext = 0, 0
+	}
+
+	if *maxCount < 0 {
+		fmt.Fprintf(os.Stderr, "mygrep: -m %d is negative\n", *maxCount)
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	failed := false
+	reportError := func(name string, err error) {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "mygrep: %s: %v\n", name, err)
+		failed = true
+	}
+
+	var template *search.Template
+	if format == search.FormatTemplate {
+		if template, err = search.ParseTemplate(*outputFormat, regexMatcher.SubexpNames()); err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: --format: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	var rules []search.Rule
+	if format == search.FormatSARIF {
+		if rules, err = makeRules(patterns, ruleIDs, regexMatcher, matchOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "error compiling regex: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	searcher := search.New(regexMatcher, strings.Join(patterns, "\n"), out, search.Options{
+		Decompress:       searchZip,
+		ArchiveDepth:     *zmax,
+		MaxMemberSize:    *maxMemberSize,
+		Mmap:             !*noMmap,
+		Encoding:         inputEncoding,
+		Binary:           binaryMode,
+		WithFilename:     len(files) > 1 || *recursive || *useIndex,
+		LineNumber:       *lineNumber,
+		ByteOffset:       *byteOffset,
+		BeforeContext:    max(*beforeContext, 0),
+		AfterContext:     max(*afterContext, 0),
+		MaxCount:         *maxCount,
+		FilesWithMatches: *filesWithMatches,
+		Quiet:            *quiet,
+		Format:           format,
+		Template:         template,
+		Hyperlink:        hyperlink,
+		Rules:            rules,
+		Regions:          regions,
+		ReportError:      reportError,
+	})
+
+	keep := func(path string) bool { return true }
+	switch {
+	case *language != "":
+		keep = func(path string) bool { return lang.Detect(path) == *language }
+	case regions != nil:
+		keep = func(path string) bool { return lang.Detect(path) != "" }
+	}
+	if *useIndex {
+		candidates, err := indexedFiles(files, patterns, matchOpts, reportError)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error compiling regex: %v\n", err)
+			os.Exit(1)
+		}
+		files = slices.DeleteFunc(candidates, func(path string) bool { return !keep(path) })
+	} else if *recursive {
+		files = walkFiles(files, keep, reportError)
+	}
+	summary, err := searcher.SearchFiles(context.Background(), files, threads, *unordered)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing output: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing output: %v\n", err)
+		os.Exit(2)
+	}
+	if err := regexMatcher.Err(); err != nil {
+		// Lines on which the VM gave up were reported as not matching.
+		fmt.Fprintf(os.Stderr, "mygrep: %v; some lines were not fully searched\n", err)
+		failed = true
+	}
+
+	switch {
+	case *quiet && summary.Matched > 0:
+		os.Exit(0)
+	case failed:
+		os.Exit(2)
+	case summary.Matched > 0:
+		os.Exit(0)
+	default:
+		os.Exit(1)
+	}
+}
+
+// vimgrepTemplate is the --format template of --vimgrep.
+const vimgrepTemplate = "{path}:{line}:{col}:{text}"
+
+// walkFiles expands directories in paths to the regular files beneath them,
+// in lexical order, keeping those found in directories only if keep accepts
+// them.
+func walkFiles(paths []string, keep func(path string) bool, reportError func(string, error)) []string {
+	var files []string
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				reportError(p, err)
+				return nil
+			}
+			if !d.IsDir() && (p == path || keep(p)) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			reportError(path, err)
+		}
+	}
+	return files
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// readPatterns reads the patterns in files, one per line; "-" is standard
+// input. A line "# id: NAME" is not a pattern but gives the rule ID of the
+// next one; ids holds it, or "" for patterns without one.
+func readPatterns(files []string) (patterns, ids []string, err error) {
+	for _, name := range files {
+		var data []byte
+		if name == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		id := ""
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if rest, ok := strings.CutPrefix(line, "# id:"); ok {
+				id = strings.TrimSpace(rest)
+				continue
+			}
+			patterns = append(patterns, line)
+			ids = append(ids, id)
+			id = ""
+		}
+	}
+	return patterns, ids, nil
+}
+
+// makeRules returns the rules of patterns for --format sarif, named by ids
+// where given and by the pattern otherwise. A single pattern uses m.
+func makeRules(patterns, ids []string, m *matcher.RegexMatcher, opts matcher.Options) ([]search.Rule, error) {
+	rules := make([]search.Rule, len(patterns))
+	for i, pattern := range patterns {
+		rules[i] = search.Rule{ID: pattern, Pattern: pattern, Matcher: m}
+		if i < len(ids) && ids[i] != "" {
+			rules[i].ID = ids[i]
+		}
+		if len(patterns) > 1 {
+			rm, err := matcher.NewRegexMatcherPatterns(patterns[i:i+1], opts)
+			if err != nil {
+				return nil, err
+			}
+			rules[i].Matcher = rm
+		}
+	}
+	return rules, nil
+}
@@ -1,6 +1,316 @@
-
+// internal/compiler/compiler.go
 package compiler
 
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// maxProgramSize keeps counted repetitions from producing programs too large
+// to load.
+const maxProgramSize = 1 << 24
+
+// Program is a compiled pattern, ready to be loaded into a pkg.VM.
+type Program struct {
+	Code []byte
+	// NumCap is the number of capturing groups; the VM reports group i in
+	// slots 2i and 2i+1.
+	NumCap int
+	// Names holds the name of each group, "" for unnamed ones.
+	Names []string
+	// Flags are the parser flags the pattern was parsed with.
+	Flags parser.Flags
+	// Literal is a string every match contains (see parser.RequiredLiteral),
+	// or "" if there is none.
+	Literal string
+	// Pattern is the source of the program. Spans maps instructions back
+	// to it, in program order, when compiled with KeepSpans.
+	Pattern string
+	Spans   []Span
+}
+
+// Span ties the instruction at PC to the pattern text [Pos, End) that it
+// was compiled from.
+type Span struct {
+	PC, Pos, End int
+}
+
+// GrepCompiler translates parsed patterns into VM bytecode.
+type GrepCompiler struct {
+	// KeepSpans records Program.Spans, for listings.
+	KeepSpans bool
+
+	code     []byte
+	ascii    bool
+	nextSlot int
+	spans    []Span
+	node     *parser.Node // node being compiled, for spans
+}
+
+// Compile compiles re into a program. The program records the whole match in
+// slots 0 and 1, so a VM can run it unanchored with Exec.
+func (c *GrepCompiler) Compile(re *parser.Regexp) (*Program, error) {
+	c.code = c.code[:0]
+	c.spans = nil
+	c.node = nil
+	c.ascii = re.Flags&parser.ASCII != 0
+	c.nextSlot = 2 * (re.NumCap + 1)
+
+	c.emitU16(pkg.OpSave, 0)
+	if err := c.compile(re.Root); err != nil {
+		return nil, err
+	}
+	c.emitU16(pkg.OpSave, 1)
+	c.op(pkg.OpMatch)
+
+	return &Program{
+		Code:    append([]byte(nil), c.code...),
+		NumCap:  re.NumCap,
+		Names:   re.Names,
+		Flags:   re.Flags,
+		Literal: parser.RequiredLiteral(re.Root),
+		Pattern: re.Pattern,
+		Spans:   c.spans,
+	}, nil
+}
+
+// Comment describes the instruction at pc for pkg.Disassemble: the offsets
+// and text of the pattern it was compiled from.
+func (p *Program) Comment(pc int) string {
+	i := sort.Search(len(p.Spans), func(i int) bool { return p.Spans[i].PC >= pc })
+	if i == len(p.Spans) || p.Spans[i].PC != pc {
+		return ""
+	}
+	sp := p.Spans[i]
+	text := p.Pattern[sp.Pos:sp.End]
+	if strconv.CanBackquote(text) {
+		return fmt.Sprintf("%d-%d `%s`", sp.Pos, sp.End, text)
+	}
+	return fmt.Sprintf("%d-%d %q", sp.Pos, sp.End, text)
+}
+
+func (c *GrepCompiler) compile(n *parser.Node) error {
+	if len(c.code) > maxProgramSize {
+		return fmt.Errorf("pattern too large: compiled program exceeds %d bytes", maxProgramSize)
+	}
+	outer := c.node
+	c.node = n
+	defer func() { c.node = outer }()
+
+	switch n.Op {
+	case parser.OpEmpty:
+	case parser.OpLiteral:
+		c.emitU32(pkg.OpChar, int(n.Rune))
+	case parser.OpAnyChar:
+		c.op(pkg.OpAny)
+	case parser.OpCharClass:
+		c.op(pkg.OpClass)
+		c.code = c.charSet(n.Class).Encode(c.code)
+	case parser.OpBeginLine:
+		c.op(pkg.OpAssert)
+		c.code = append(c.code, pkg.AssertBegin)
+	case parser.OpEndLine:
+		c.op(pkg.OpAssert)
+		c.code = append(c.code, pkg.AssertEnd)
+	case parser.OpWordBoundary:
+		kind := pkg.AssertWordBoundary
+		if c.ascii {
+			kind = pkg.AssertWordBoundaryASCII
+		}
+		c.op(pkg.OpAssert)
+		c.code = append(c.code, kind)
+	case parser.OpNoWordBoundary:
+		kind := pkg.AssertNoWordBoundary
+		if c.ascii {
+			kind = pkg.AssertNoWordBoundaryASCII
+		}
+		c.op(pkg.OpAssert)
+		c.code = append(c.code, kind)
+	case parser.OpCapture:
+		c.emitU16(pkg.OpSave, 2*n.Cap)
+		if err := c.compile(n.Subs[0]); err != nil {
+			return err
+		}
+		c.emitU16(pkg.OpSave, 2*n.Cap+1)
+	case parser.OpConcat:
+		for _, sub := range n.Subs {
+			if err := c.compile(sub); err != nil {
+				return err
+			}
+		}
+	case parser.OpAlternate:
+		var exits []int
+		for i, sub := range n.Subs {
+			if i == len(n.Subs)-1 {
+				if err := c.compile(sub); err != nil {
+					return err
+				}
+				break
+			}
+			split := c.emitSplit()
+			c.patch(split+1, len(c.code))
+			if err := c.compile(sub); err != nil {
+				return err
+			}
+			exits = append(exits, c.emitU32(pkg.OpJmp, 0))
+			c.patch(split+5, len(c.code))
+		}
+		for _, jmp := range exits {
+			c.patch(jmp+1, len(c.code))
+		}
+	case parser.OpRepeat:
+		return c.compileRepeat(n)
+	case parser.OpBackref:
+		c.emitU16(pkg.OpBackref, n.Cap)
+	case parser.OpLookahead:
+		var negate byte
+		if n.Negate {
+			negate = 1
+		}
+		look := c.op(pkg.OpLook)
+		c.code = append(c.code, negate)
+		c.code = binary.LittleEndian.AppendUint32(c.code, 0)
+		if err := c.compile(n.Subs[0]); err != nil {
+			return err
+		}
+		c.op(pkg.OpLookEnd)
+		c.patch(look+2, len(c.code))
+	default:
+		return fmt.Errorf("unsupported syntax node %d", n.Op)
+	}
+	return nil
+}
+
+// compileRepeat unrolls the mandatory copies of the operand, then either loops
+// (unbounded) or nests the optional copies so a failed copy skips the rest.
+func (c *GrepCompiler) compileRepeat(n *parser.Node) error {
+	sub := n.Subs[0]
+	for i := 0; i < n.Min; i++ {
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+	}
+
+	if n.Max < 0 {
+		loop := c.emitSplit()
+		body := len(c.code)
+		mark := -1
+		if nullable(sub) {
+			// An iteration that consumes nothing would loop forever.
+			mark = c.nextSlot
+			c.nextSlot++
+			c.emitU16(pkg.OpSave, mark)
+		}
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+		if mark >= 0 {
+			c.emitU16(pkg.OpProgress, mark)
+		}
+		c.emitU32(pkg.OpJmp, loop)
+		c.patchSplit(loop, body, len(c.code), n.Greedy)
+		return nil
+	}
+
+	var splits []int
+	for i := n.Min; i < n.Max; i++ {
+		split := c.emitSplit()
+		splits = append(splits, split)
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+	}
+	for _, split := range splits {
+		c.patchSplit(split, split+9, len(c.code), n.Greedy)
+	}
+	return nil
+}
+
+// charSet converts a parsed class into the VM's class operand.
+func (c *GrepCompiler) charSet(class *parser.CharClass) *pkg.CharSet {
+	set := &pkg.CharSet{Negate: class.Negate}
+	for _, r := range class.Ranges {
+		set.Items = append(set.Items, pkg.ClassItem{Lo: r.Lo, Hi: r.Hi})
+	}
+	for _, ref := range class.Classes {
+		set.Items = append(set.Items, pkg.ClassItem{Named: ref.ID, Negate: ref.Negate, ASCII: c.ascii})
+	}
+	for _, prop := range class.Props {
+		set.Items = append(set.Items, pkg.ClassItem{Prop: prop.Name, Negate: prop.Negate})
+	}
+	return set
+}
+
+// nullable reports whether n can match without consuming input.
+func nullable(n *parser.Node) bool {
+	switch n.Op {
+	case parser.OpLiteral, parser.OpAnyChar, parser.OpCharClass:
+		return false
+	case parser.OpCapture:
+		return nullable(n.Subs[0])
+	case parser.OpConcat:
+		for _, sub := range n.Subs {
+			if !nullable(sub) {
+				return false
+			}
+		}
+		return true
+	case parser.OpAlternate:
+		for _, sub := range n.Subs {
+			if nullable(sub) {
+				return true
+			}
+		}
+		return false
+	case parser.OpRepeat:
+		return n.Min == 0 || nullable(n.Subs[0])
+	}
+	return true
+}
+
+// op appends an opcode, recording the span of the node being compiled, and
+// returns its offset.
+func (c *GrepCompiler) op(op byte) int {
+	pc := len(c.code)
+	if c.KeepSpans && c.node != nil {
+		c.spans = append(c.spans, Span{PC: pc, Pos: c.node.Pos, End: c.node.End})
+	}
+	c.code = append(c.code, op)
+	return pc
+}
+
+func (c *GrepCompiler) emitU16(op byte, v int) int {
+	pc := c.op(op)
+	c.code = binary.LittleEndian.AppendUint16(c.code, uint16(v))
+	return pc
+}
+
+func (c *GrepCompiler) emitU32(op byte, v int) int {
+	pc := c.op(op)
+	c.code = binary.LittleEndian.AppendUint32(c.code, uint32(v))
+	return pc
+}
+
+func (c *GrepCompiler) emitSplit() int {
+	pc := c.op(pkg.OpSplit)
+	c.code = append(c.code, 0, 0, 0, 0, 0, 0, 0, 0)
+	return pc
+}
 
+// patchSplit points a split at body and exit, preferring body when greedy.
+func (c *GrepCompiler) patchSplit(split, body, exit int, greedy bool) {
+	if !greedy {
+		body, exit = exit, body
+	}
+	c.patch(split+1, body)
+	c.patch(split+5, exit)
+}
 
-type GrepCompiler struct{}
+func (c *GrepCompiler) patch(off, target int) {
+	binary.LittleEndian.PutUint32(c.code[off:], uint32(target))
+}
@@ -0,0 +1,145 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// FormatVersion is the version of the binary program format. It changes
+// whenever the format or the code the compiler emits does, so programs
+// stored by another version are compiled again.
+const FormatVersion = 1
+
+// A stored program is a header
+//
+//	magic "MGRP", version u16, flags u16, hash [32]byte
+//
+// where flags are the parser.Flags the program was compiled with and hash is
+// Hash of the pattern and flags, then the program
+//
+//	code, numCap u32, names u32 + strings, literal, pattern
+//
+// with byte strings prefixed by their u32 length, and a CRC-32 (IEEE) of all
+// the preceding bytes. Integers are little-endian. Spans are not stored.
+const (
+	magic      = "MGRP"
+	headerSize = len(magic) + 2 + 2 + sha256.Size
+)
+
+var (
+	// ErrFormat reports data that is not a stored program or is damaged.
+	ErrFormat = errors.New("not a valid compiled program")
+	// ErrVersion reports a program stored in another format version.
+	ErrVersion = errors.New("unsupported compiled program version")
+)
+
+// Hash identifies a pattern compiled with flags, as a hex string suitable
+// for a file name.
+func Hash(pattern string, flags parser.Flags) string {
+	sum := hashOf(pattern, flags)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashOf(pattern string, flags parser.Flags) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte{byte(flags)}, pattern...))
+}
+
+// MarshalBinary encodes p in the stored program format.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, headerSize+len(p.Code)+len(p.Pattern)+64)
+	b = append(b, magic...)
+	b = binary.LittleEndian.AppendUint16(b, FormatVersion)
+	b = binary.LittleEndian.AppendUint16(b, uint16(p.Flags))
+	sum := hashOf(p.Pattern, p.Flags)
+	b = append(b, sum[:]...)
+
+	b = appendBytes(b, p.Code)
+	b = binary.LittleEndian.AppendUint32(b, uint32(p.NumCap))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(p.Names)))
+	for _, name := range p.Names {
+		b = appendBytes(b, []byte(name))
+	}
+	b = appendBytes(b, []byte(p.Literal))
+	b = appendBytes(b, []byte(p.Pattern))
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b)), nil
+}
+
+// UnmarshalBinary decodes a program stored by MarshalBinary. It returns
+// ErrVersion for another format version and ErrFormat, possibly wrapped, for
+// damaged data or code that pkg.Verify rejects.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize+4 || string(data[:len(magic)]) != magic {
+		return ErrFormat
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != FormatVersion {
+		return fmt.Errorf("%w %d, want %d", ErrVersion, v, FormatVersion)
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrFormat)
+	}
+
+	d := decoder{buf: body[headerSize:]}
+	var q Program
+	q.Flags = parser.Flags(binary.LittleEndian.Uint16(data[6:]))
+	q.Code = append([]byte(nil), d.bytes()...)
+	q.NumCap = d.u32()
+	for n := d.u32(); len(q.Names) < n && !d.err; {
+		q.Names = append(q.Names, string(d.bytes()))
+	}
+	q.Literal = string(d.bytes())
+	q.Pattern = string(d.bytes())
+	switch {
+	case d.err || len(d.buf) != 0:
+		return fmt.Errorf("%w: bad length", ErrFormat)
+	case hashOf(q.Pattern, q.Flags) != [sha256.Size]byte(data[8:headerSize]):
+		return fmt.Errorf("%w: pattern hash mismatch", ErrFormat)
+	case len(q.Names) != q.NumCap+1:
+		return fmt.Errorf("%w: %d group names for %d groups", ErrFormat, len(q.Names), q.NumCap)
+	}
+	if err := pkg.Verify(q.Code); err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	*p = q
+	return nil
+}
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads the fields of a stored program; err is set once a read runs
+// past the end.
+type decoder struct {
+	buf []byte
+	err bool
+}
+
+func (d *decoder) u32() int {
+	if len(d.buf) < 4 {
+		d.err, d.buf = true, nil
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return int(v)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.u32()
+	if n > len(d.buf) {
+		d.err, d.buf = true, nil
+		return nil
+	}
+	s := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return s
+}
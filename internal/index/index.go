@@ -0,0 +1,438 @@
+// Package index keeps a trigram index of the files under a directory, so a
+// search can skip the files that cannot contain a match.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dir is the directory, within the indexed root, that holds the index.
+const Dir = ".mygrep-index"
+
+// FormatVersion is the version of the segment file format.
+const FormatVersion = 2
+
+// manifestName is the file listing the segments of the index, one per
+// line after a header line.
+const manifestName = "MANIFEST"
+
+const manifestHeader = "mygrep-index 1"
+
+// lockName is the file present in the index directory while a build or an
+// update writes to it.
+const lockName = "LOCK"
+
+// Index is an index opened for queries.
+type Index struct {
+	root string
+	segs []*segment
+}
+
+// Build indexes the regular files under root, replacing any index already
+// there.
+func Build(root string) error {
+	dir := filepath.Join(root, Dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	unlock, err := lock(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	b := newBuilder()
+	err = walk(root, func(f FileInfo, path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b.add(f, data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return commit(dir, nil, b.segment())
+}
+
+// Open opens the index of root. An update may replace the segments of the
+// index while it is opened; Open then reads the new manifest.
+func Open(root string) (*Index, error) {
+	dir := filepath.Join(root, Dir)
+	for attempt := 0; ; attempt++ {
+		segs, err := loadSegments(dir)
+		if errors.Is(err, fs.ErrNotExist) && attempt < openAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Index{root: root, segs: segs}, nil
+	}
+}
+
+// openAttempts is how many times Open rereads a manifest whose segments
+// were removed before it could read them.
+const openAttempts = 10
+
+// loadSegments reads the segments listed in the manifest in dir and marks
+// the live files in each.
+func loadSegments(dir string) ([]*segment, error) {
+	names, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []*segment
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		s, err := decodeSegment(name, data)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, s)
+	}
+
+	// Walk the segments newest first; the first entry for a path is live.
+	seen := make(map[string]bool)
+	for i := len(segs) - 1; i >= 0; i-- {
+		s := segs[i]
+		s.live = make([]bool, len(s.files))
+		for id, f := range s.files {
+			s.live[id] = !seen[f.Path]
+			seen[f.Path] = true
+		}
+		for _, path := range s.deleted {
+			seen[path] = true
+		}
+	}
+	return segs, nil
+}
+
+// Files returns the paths of the indexed files that may satisfy q, joined
+// with the root and in lexical order.
+func (ix *Index) Files(q *Query) []string {
+	var paths []string
+	for _, s := range ix.segs {
+		ids, every := s.eval(q)
+		for id, f := range s.files {
+			if len(ids) > 0 && ids[0] == id {
+				ids = ids[1:]
+			} else if !every && f.flags&flagUnindexed == 0 {
+				continue
+			}
+			if !s.live[id] {
+				continue
+			}
+			paths = append(paths, ix.path(f))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (ix *Index) path(f FileInfo) string {
+	return filepath.Join(ix.root, filepath.FromSlash(f.Path))
+}
+
+// eval returns the files of s satisfying q in ascending order; every is set
+// instead if q holds for all of them.
+func (s *segment) eval(q *Query) (ids []int, every bool) {
+	switch q.Op {
+	case QAll:
+		return nil, true
+	case QTrigram:
+		return s.postingList(trigramKey(q.Trigram)), false
+	case QAnd:
+		every = true
+		for _, sub := range q.Subs {
+			list, subEvery := s.eval(sub)
+			switch {
+			case subEvery:
+			case every:
+				ids, every = list, false
+			default:
+				ids = intersect(ids, list)
+			}
+		}
+		return ids, every
+	case QOr:
+		for _, sub := range q.Subs {
+			list, subEvery := s.eval(sub)
+			if subEvery {
+				return nil, true
+			}
+			ids = union(ids, list)
+		}
+		return ids, false
+	}
+	return nil, true
+}
+
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func union(a, b []int) []int {
+	out := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// builder collects the files and posting lists of a new segment.
+type builder struct {
+	files   []FileInfo
+	deleted []string
+	lists   map[uint32][]int
+	set     *trigramSet
+}
+
+func newBuilder() *builder {
+	return &builder{lists: make(map[uint32][]int), set: newTrigramSet()}
+}
+
+// add indexes f with content data.
+func (b *builder) add(f FileInfo, data []byte) {
+	id := len(b.files)
+	f.Hash = sha256.Sum256(data)
+	if hasBOM(data) {
+		// The file is searched after transcoding, which the trigrams of
+		// its bytes would not reflect.
+		f.flags |= flagUnindexed
+	} else {
+		for _, t := range b.set.collect(data) {
+			b.lists[t] = append(b.lists[t], id)
+		}
+	}
+	b.files = append(b.files, f)
+}
+
+func (b *builder) segment() []byte {
+	return encodeSegment(b.files, b.deleted, b.lists)
+}
+
+func trigramKey(t string) uint32 {
+	return uint32(t[0])<<16 | uint32(t[1])<<8 | uint32(t[2])
+}
+
+// trigramSet collects the distinct trigrams of a file. Trigrams spanning a
+// newline are left out: no match does.
+type trigramSet struct {
+	bits []uint64
+	list []uint32
+}
+
+func newTrigramSet() *trigramSet {
+	return &trigramSet{bits: make([]uint64, 1<<24/64)}
+}
+
+// collect returns the trigrams of data in the order first seen. The result
+// is valid until the next call.
+func (s *trigramSet) collect(data []byte) []uint32 {
+	for _, t := range s.list {
+		s.bits[t/64] &^= 1 << (t % 64)
+	}
+	s.list = s.list[:0]
+	for i := 0; i+3 <= len(data); i++ {
+		if data[i+2] == '\n' {
+			i += 2
+			continue
+		}
+		if data[i] == '\n' || data[i+1] == '\n' {
+			continue
+		}
+		t := uint32(data[i])<<16 | uint32(data[i+1])<<8 | uint32(data[i+2])
+		if s.bits[t/64]&(1<<(t%64)) == 0 {
+			s.bits[t/64] |= 1 << (t % 64)
+			s.list = append(s.list, t)
+		}
+	}
+	return s.list
+}
+
+// hasBOM reports whether data starts with a UTF-16 byte order mark.
+func hasBOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF})
+}
+
+// walk calls fn, in lexical order, with each regular file under root and
+// its path, skipping the index itself. The Hash of the file is not set.
+func walk(root string, fn func(f FileInfo, path string) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == Dir && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		return fn(FileInfo{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UnixNano()}, p)
+	})
+}
+
+// readManifest returns the segment names listed in the manifest in dir.
+func readManifest(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no index in %s; run mygrep index build first", filepath.Dir(dir))
+		}
+		return nil, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || sc.Text() != manifestHeader {
+		return nil, fmt.Errorf("%s: not a mygrep index manifest", filepath.Join(dir, manifestName))
+	}
+	var names []string
+	for sc.Scan() {
+		if name := sc.Text(); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// nextSegmentName returns a segment name not yet used in dir.
+func nextSegmentName(dir string) string {
+	n := 0
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if num, ok := segmentNumber(e.Name()); ok && num >= n {
+			n = num + 1
+		}
+	}
+	return fmt.Sprintf("seg-%d.idx", n)
+}
+
+func segmentNumber(name string) (int, bool) {
+	s, ok := strings.CutPrefix(name, "seg-")
+	if !ok {
+		return 0, false
+	}
+	if s, ok = strings.CutSuffix(s, ".idx"); !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// commit writes a new segment to dir and a manifest listing it after the
+// segments in keep, then removes the segments no longer listed. Readers
+// that opened the old manifest retry with the new one (see Open).
+func commit(dir string, keep []string, data []byte) error {
+	name := nextSegmentName(dir)
+	if err := writeFile(dir, name, data); err != nil {
+		return err
+	}
+	names := append(keep[:len(keep):len(keep)], name)
+	manifest := manifestHeader + "\n" + strings.Join(names, "\n") + "\n"
+	if err := writeFile(dir, manifestName, []byte(manifest)); err != nil {
+		os.Remove(filepath.Join(dir, name))
+		return err
+	}
+	removeStale(dir, names)
+	return nil
+}
+
+// lock takes the lock file of the index in dir, so that one build or update
+// runs at a time, and returns the function that releases it.
+func lock(dir string) (func(), error) {
+	path := filepath.Join(dir, lockName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s is being updated (remove %s if no update is running)", filepath.Dir(dir), path)
+		}
+		return nil, err
+	}
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+// removeStale removes the segments in dir other than keep.
+func removeStale(dir string, keep []string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if _, ok := segmentNumber(e.Name()); ok && !slices.Contains(keep, e.Name()) {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// writeFile writes data to name in dir under a temporary name and renames
+// it into place, so readers see either the old file or the new one.
+func writeFile(dir, name string, data []byte) error {
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+)
+
+// maxExact bounds the sets of strings tracked while building a query;
+// beyond it a node is treated as matching unknown text.
+const maxExact = 16
+
+// QueryOp is the kind of a Query node.
+type QueryOp int
+
+const (
+	QAll     QueryOp = iota // any file may match
+	QTrigram                // files containing Trigram
+	QAnd                    // files matching all of Subs
+	QOr                     // files matching any of Subs
+)
+
+// Query is a boolean query over trigrams. Every file that a pattern can
+// match satisfies the pattern's query; the converse need not hold.
+type Query struct {
+	Op      QueryOp
+	Trigram string
+	Subs    []*Query
+}
+
+var all = &Query{Op: QAll}
+
+func (q *Query) String() string {
+	switch q.Op {
+	case QAll:
+		return "+"
+	case QTrigram:
+		return q.Trigram
+	}
+	subs := make([]string, len(q.Subs))
+	for i, sub := range q.Subs {
+		subs[i] = sub.String()
+	}
+	sep := " "
+	if q.Op == QOr {
+		sep = "|"
+	}
+	return "(" + strings.Join(subs, sep) + ")"
+}
+
+func and(a, b *Query) *Query {
+	switch {
+	case a.Op == QAll:
+		return b
+	case b.Op == QAll:
+		return a
+	}
+	q := &Query{Op: QAnd}
+	for _, x := range []*Query{a, b} {
+		if x.Op == QAnd {
+			q.Subs = append(q.Subs, x.Subs...)
+		} else {
+			q.Subs = append(q.Subs, x)
+		}
+	}
+	return q
+}
+
+func or(a, b *Query) *Query {
+	if a.Op == QAll || b.Op == QAll {
+		return all
+	}
+	q := &Query{Op: QOr}
+	for _, x := range []*Query{a, b} {
+		if x.Op == QOr {
+			q.Subs = append(q.Subs, x.Subs...)
+		} else {
+			q.Subs = append(q.Subs, x)
+		}
+	}
+	return q
+}
+
+// trigramsOf returns the query for files containing s.
+func trigramsOf(s string) *Query {
+	q := all
+	seen := make(map[string]bool)
+	for i := 0; i+3 <= len(s); i++ {
+		// The index leaves out trigrams spanning lines.
+		if t := s[i : i+3]; !seen[t] && !strings.Contains(t, "\n") {
+			seen[t] = true
+			q = and(q, &Query{Op: QTrigram, Trigram: t})
+		}
+	}
+	return q
+}
+
+// anyOf returns the query for files containing one of set.
+func anyOf(set []string) *Query {
+	var q *Query
+	for _, s := range set {
+		t := trigramsOf(s)
+		if q == nil {
+			q = t
+		} else {
+			q = or(q, t)
+		}
+	}
+	if q == nil {
+		return all
+	}
+	return q
+}
+
+// info is what is known of the text a node matches: exact, when not nil, is
+// every string it can match; match must hold for the file regardless.
+type info struct {
+	exact []string
+	match *Query
+}
+
+// query returns the whole query for i.
+func (i info) query() *Query {
+	if i.exact == nil {
+		return i.match
+	}
+	return and(i.match, anyOf(i.exact))
+}
+
+// RegexpQuery returns the trigram query for files in which re can match.
+func RegexpQuery(re *parser.Regexp) *Query {
+	return analyze(re.Root).query()
+}
+
+func analyze(n *parser.Node) info {
+	switch n.Op {
+	case parser.OpLiteral:
+		return info{exact: []string{string(n.Rune)}, match: all}
+	case parser.OpEmpty, parser.OpBeginLine, parser.OpEndLine, parser.OpWordBoundary, parser.OpNoWordBoundary, parser.OpLookahead:
+		return info{exact: []string{""}, match: all}
+	case parser.OpCharClass:
+		if set := classRunes(n.Class); set != nil {
+			return info{exact: set, match: all}
+		}
+	case parser.OpCapture:
+		return analyze(n.Subs[0])
+	case parser.OpConcat:
+		acc := info{exact: []string{""}, match: all}
+		for _, sub := range n.Subs {
+			acc = concat(acc, analyze(sub))
+		}
+		return acc
+	case parser.OpAlternate:
+		acc := analyze(n.Subs[0])
+		for _, sub := range n.Subs[1:] {
+			acc = alternate(acc, analyze(sub))
+		}
+		return acc
+	case parser.OpRepeat:
+		sub := analyze(n.Subs[0])
+		switch {
+		case n.Min == 0 && n.Max == 1:
+			return alternate(info{exact: []string{""}, match: all}, sub)
+		case n.Min == 0:
+			return info{match: all}
+		case n.Min == n.Max && sub.exact != nil:
+			acc := sub
+			for i := 1; i < n.Min && acc.exact != nil; i++ {
+				acc = concat(acc, sub)
+			}
+			return acc
+		}
+		// One copy must be there, and more may follow.
+		return info{match: sub.query()}
+	}
+	// Any character, a large class or a backreference.
+	return info{match: all}
+}
+
+// concat combines the infos of two nodes matched one after the other.
+func concat(a, b info) info {
+	if a.exact != nil && b.exact != nil && len(a.exact)*len(b.exact) <= maxExact {
+		var exact []string
+		for _, x := range a.exact {
+			for _, y := range b.exact {
+				exact = append(exact, x+y)
+			}
+		}
+		return info{exact: dedupe(exact), match: and(a.match, b.match)}
+	}
+	// The strings on either side are still required, apart, and the text
+	// still ends with one of b's.
+	if b.exact != nil {
+		return info{exact: b.exact, match: and(a.query(), b.match)}
+	}
+	return info{match: and(a.query(), b.query())}
+}
+
+// alternate combines the infos of two alternatives.
+func alternate(a, b info) info {
+	if a.exact != nil && b.exact != nil && len(a.exact)+len(b.exact) <= maxExact {
+		return info{exact: dedupe(append(append([]string(nil), a.exact...), b.exact...)), match: or(a.match, b.match)}
+	}
+	return info{match: or(a.query(), b.query())}
+}
+
+// classRunes returns the strings a class matches if it is a small set of
+// runes, or nil.
+func classRunes(c *parser.CharClass) []string {
+	if c.Negate || len(c.Classes) > 0 || len(c.Props) > 0 {
+		return nil
+	}
+	var set []string
+	for _, r := range c.Ranges {
+		if int(r.Hi-r.Lo)+1+len(set) > maxExact {
+			return nil
+		}
+		for x := r.Lo; x <= r.Hi; x++ {
+			set = append(set, string(x))
+		}
+	}
+	return dedupe(set)
+}
+
+func dedupe(set []string) []string {
+	sort.Strings(set)
+	out := set[:0]
+	for i, s := range set {
+		if i == 0 || s != set[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
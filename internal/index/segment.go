@@ -0,0 +1,204 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// A segment file is
+//
+//	magic "MGIS", version u16
+//	files u32, then for each: path, size i64, mtime i64, sha256 [32]u8,
+//	flags u8
+//	deleted u32, then for each: path
+//	trigrams u32, then for each: trigram u32, postings offset u32
+//	postings: length u32, then for each trigram its file numbers as
+//	ascending uvarint deltas
+//
+// with paths prefixed by their u32 length and a CRC-32 (IEEE) of all the
+// preceding bytes at the end. Integers are little-endian.
+const segmentMagic = "MGIS"
+
+// errCorrupt reports a damaged segment file.
+var errCorrupt = errors.New("corrupt index segment")
+
+// File flags.
+const (
+	// flagUnindexed marks a file whose content was not indexed, such as a
+	// UTF-16 file: it is a candidate for every query.
+	flagUnindexed byte = 1 << iota
+)
+
+// FileInfo describes an indexed file.
+type FileInfo struct {
+	Path    string // relative to the index root, with forward slashes
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+	Hash    [sha256.Size]byte
+	flags   byte
+}
+
+// segment is a set of files with the posting list of each trigram found in
+// them. Files are numbered by their position in files. A segment overrides
+// the entries of earlier segments for its files and its deleted paths.
+type segment struct {
+	name     string
+	files    []FileInfo
+	deleted  []string
+	live     []bool   // files not overridden by a later segment
+	trigrams []uint32 // ascending
+	offsets  []uint32 // start of each posting list in postings
+	postings []byte
+}
+
+// postingList returns the files containing trigram t, in ascending order.
+func (s *segment) postingList(t uint32) []int {
+	i := sort.Search(len(s.trigrams), func(i int) bool { return s.trigrams[i] >= t })
+	if i == len(s.trigrams) || s.trigrams[i] != t {
+		return nil
+	}
+	return s.postingsAt(i)
+}
+
+// postingsAt returns the posting list of the i'th trigram.
+func (s *segment) postingsAt(i int) []int {
+	end := len(s.postings)
+	if i+1 < len(s.offsets) {
+		end = int(s.offsets[i+1])
+	}
+	var list []int
+	buf, id := s.postings[s.offsets[i]:end], 0
+	for len(buf) > 0 {
+		delta, n := binary.Uvarint(buf)
+		if n <= 0 {
+			break
+		}
+		id += int(delta)
+		list = append(list, id)
+		buf = buf[n:]
+	}
+	return list
+}
+
+// encodeSegment encodes files, the paths deleted since earlier segments
+// and the posting lists of the files' trigrams, given as file numbers in
+// ascending order.
+func encodeSegment(files []FileInfo, deleted []string, lists map[uint32][]int) []byte {
+	b := []byte(segmentMagic)
+	b = binary.LittleEndian.AppendUint16(b, FormatVersion)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(files)))
+	for _, f := range files {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(f.Path)))
+		b = append(b, f.Path...)
+		b = binary.LittleEndian.AppendUint64(b, uint64(f.Size))
+		b = binary.LittleEndian.AppendUint64(b, uint64(f.ModTime))
+		b = append(b, f.Hash[:]...)
+		b = append(b, f.flags)
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(deleted)))
+	for _, path := range deleted {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(path)))
+		b = append(b, path...)
+	}
+
+	trigrams := make([]uint32, 0, len(lists))
+	for t := range lists {
+		trigrams = append(trigrams, t)
+	}
+	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
+	var postings []byte
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(trigrams)))
+	for _, t := range trigrams {
+		b = binary.LittleEndian.AppendUint32(b, t)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(postings)))
+		prev := 0
+		for _, id := range lists[t] {
+			postings = binary.AppendUvarint(postings, uint64(id-prev))
+			prev = id
+		}
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(postings)))
+	b = append(b, postings...)
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func decodeSegment(name string, data []byte) (*segment, error) {
+	if len(data) < 10 || string(data[:4]) != segmentMagic {
+		return nil, fmt.Errorf("%s: %w", name, errCorrupt)
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != FormatVersion {
+		return nil, fmt.Errorf("%s: index format version %d, want %d; rebuild the index", name, v, FormatVersion)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%s: %w: checksum mismatch", name, errCorrupt)
+	}
+
+	d := decoder{buf: body[6:]}
+	s := &segment{name: name}
+	for n := d.u32(); len(s.files) < n && d.err == nil; {
+		var f FileInfo
+		f.Path = string(d.bytes(d.u32()))
+		f.Size = int64(d.u64())
+		f.ModTime = int64(d.u64())
+		copy(f.Hash[:], d.bytes(sha256.Size))
+		if flags := d.bytes(1); len(flags) == 1 {
+			f.flags = flags[0]
+		}
+		s.files = append(s.files, f)
+	}
+	for n := d.u32(); len(s.deleted) < n && d.err == nil; {
+		s.deleted = append(s.deleted, string(d.bytes(d.u32())))
+	}
+	for n := d.u32(); len(s.trigrams) < n && d.err == nil; {
+		s.trigrams = append(s.trigrams, uint32(d.u32()))
+		s.offsets = append(s.offsets, uint32(d.u32()))
+	}
+	s.postings = d.bytes(d.u32())
+	if d.err != nil || len(d.buf) != 0 {
+		return nil, fmt.Errorf("%s: %w: bad length", name, errCorrupt)
+	}
+	for _, off := range s.offsets {
+		if int(off) > len(s.postings) {
+			return nil, fmt.Errorf("%s: %w: bad posting offset", name, errCorrupt)
+		}
+	}
+	return s, nil
+}
+
+// decoder reads the fields of a segment; err is set once a read runs past
+// the end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if n > len(d.buf) {
+		d.err, d.buf = errCorrupt, nil
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u32() int {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(b))
+}
+
+func (d *decoder) u64() uint64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
@@ -0,0 +1,133 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MaxSegments is how many segments an index may have. An update that would
+// add one more merges them all into one instead.
+const MaxSegments = 4
+
+// Stats counts the files an update found added, changed and removed.
+type Stats struct {
+	Added, Changed, Removed int
+}
+
+// Update brings the index of root up to date with the files under it. A
+// file whose size and modification time are those indexed is taken to be
+// unchanged; any other is read, and counted as changed if its content hash
+// differs. The files read and the paths removed go into a new segment, which
+// overrides their entries in the older ones, unless the index already has
+// MaxSegments: then all are merged into one.
+func Update(root string) (Stats, error) {
+	var st Stats
+	dir := filepath.Join(root, Dir)
+	if _, err := readManifest(dir); err != nil {
+		return st, err
+	}
+	unlock, err := lock(dir)
+	if err != nil {
+		return st, err
+	}
+	defer unlock()
+
+	segs, err := loadSegments(dir)
+	if err != nil {
+		return st, err
+	}
+	indexed := make(map[string]FileInfo)
+	for _, s := range segs {
+		for id, f := range s.files {
+			if s.live[id] {
+				indexed[f.Path] = f
+			}
+		}
+		for _, path := range s.deleted {
+			delete(indexed, path)
+		}
+	}
+
+	b := newBuilder()
+	err = walk(root, func(f FileInfo, path string) error {
+		old, ok := indexed[f.Path]
+		delete(indexed, f.Path)
+		if ok && old.Size == f.Size && old.ModTime == f.ModTime {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b.add(f, data)
+		switch {
+		case !ok:
+			st.Added++
+		case b.files[len(b.files)-1].Hash != old.Hash:
+			st.Changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	for path := range indexed {
+		b.deleted = append(b.deleted, path)
+	}
+	sort.Strings(b.deleted)
+	st.Removed = len(b.deleted)
+	if len(b.files) == 0 && len(b.deleted) == 0 {
+		return st, nil
+	}
+
+	if len(segs) >= MaxSegments {
+		return st, commit(dir, nil, merge(segs, b))
+	}
+	names := make([]string, len(segs))
+	for i, s := range segs {
+		names[i] = s.name
+	}
+	return st, commit(dir, names, b.segment())
+}
+
+// merge encodes one segment holding the live files of segs that b does not
+// override, followed by the files of b. The posting lists of segs are
+// renumbered rather than rebuilt from the files.
+func merge(segs []*segment, b *builder) []byte {
+	overridden := make(map[string]bool)
+	for _, f := range b.files {
+		overridden[f.Path] = true
+	}
+	for _, path := range b.deleted {
+		overridden[path] = true
+	}
+
+	var files []FileInfo
+	lists := make(map[uint32][]int)
+	for _, s := range segs {
+		ids := make([]int, len(s.files)) // new number of each file, or -1
+		for id, f := range s.files {
+			ids[id] = -1
+			if s.live[id] && !overridden[f.Path] {
+				ids[id] = len(files)
+				files = append(files, f)
+			}
+		}
+		for i, t := range s.trigrams {
+			for _, id := range s.postingsAt(i) {
+				if id < len(ids) && ids[id] >= 0 {
+					lists[t] = append(lists[t], ids[id])
+				}
+			}
+		}
+	}
+	base := len(files)
+	files = append(files, b.files...)
+	for t, list := range b.lists {
+		for _, id := range list {
+			lists[t] = append(lists[t], base+id)
+		}
+	}
+	return encodeSegment(files, nil, lists)
+}
@@ -0,0 +1,150 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrMemberTooLarge is reported for archive members above the size cap.
+var ErrMemberTooLarge = errors.New("archive member exceeds size limit")
+
+// Archive identifies an archive format.
+type Archive int
+
+const (
+	NotArchive Archive = iota
+	Tar
+	Zip
+)
+
+// archiveSniffLen is how much of a stream DetectArchive needs to see.
+const archiveSniffLen = 262
+
+// DetectArchive identifies an archive from its first bytes. A tar header
+// carries its magic at offset 257, so head should hold at least 262 bytes.
+func DetectArchive(head []byte) Archive {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return Zip
+	case len(head) >= archiveSniffLen && bytes.Equal(head[257:262], []byte("ustar")):
+		return Tar
+	}
+	return NotArchive
+}
+
+// MemberFunc receives each regular file of an archive. If the member cannot
+// be read (for example because it is larger than the cap) r is nil and err
+// says why; the walk carries on with the next member.
+type MemberFunc func(path string, r io.Reader, err error)
+
+// WalkArchive calls fn for every regular file in the archive read from r,
+// in archive order. Members are cut off with ErrMemberTooLarge once they
+// exceed maxSize bytes. Zip archives need random access: r is used directly
+// when it is an *os.File and buffered in memory otherwise, up to maxSize
+// bytes like a member.
+// The returned error reports a corrupt archive, or a buffered zip over the
+// cap with ErrMemberTooLarge.
+func WalkArchive(r io.Reader, kind Archive, maxSize int64, fn MemberFunc) error {
+	switch kind {
+	case Tar:
+		return walkTar(r, maxSize, fn)
+	case Zip:
+		return walkZip(r, maxSize, fn)
+	}
+	return fmt.Errorf("not an archive")
+}
+
+func walkTar(r io.Reader, maxSize int64, fn MemberFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size > maxSize {
+			fn(hdr.Name, nil, ErrMemberTooLarge)
+			continue
+		}
+		fn(hdr.Name, tr, nil)
+	}
+}
+
+func walkZip(r io.Reader, maxSize int64, fn MemberFunc) error {
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		ra, size = f, info.Size()
+	} else {
+		data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > maxSize {
+			return fmt.Errorf("buffering zip: %w", ErrMemberTooLarge)
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		if zf.UncompressedSize64 > uint64(maxSize) {
+			fn(zf.Name, nil, ErrMemberTooLarge)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			fn(zf.Name, nil, err)
+			continue
+		}
+		// The header size is only a claim; enforce the cap on what is read.
+		fn(zf.Name, &cappedReader{r: rc, left: maxSize}, nil)
+		rc.Close()
+	}
+	return nil
+}
+
+// cappedReader fails with ErrMemberTooLarge instead of returning more than
+// left bytes.
+type cappedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.left <= 0 {
+		var probe [1]byte
+		if n, _ := c.r.Read(probe[:]); n > 0 {
+			return 0, ErrMemberTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.r.Read(p)
+	c.left -= int64(n)
+	return n, err
+}
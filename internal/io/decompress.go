@@ -0,0 +1,104 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+// Compression identifies the format of a compressed stream.
+type Compression int
+
+const (
+	Uncompressed Compression = iota
+	Gzip
+	Bzip2
+	Zlib
+	LZW // Unix compress (.Z)
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	case Zlib:
+		return "zlib"
+	case LZW:
+		return "compress"
+	}
+	return "uncompressed"
+}
+
+// DetectCompression identifies a compressed stream from its first bytes.
+func DetectCompression(head []byte) Compression {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return Gzip
+	case bytes.HasPrefix(head, []byte("BZh")) && len(head) >= 4 && '1' <= head[3] && head[3] <= '9':
+		return Bzip2
+	case bytes.HasPrefix(head, []byte{0x1f, 0x9d}):
+		return LZW
+	case len(head) >= 2 && head[0] == 0x78 && (head[1] == 0x01 || head[1] == 0x5e || head[1] == 0x9c || head[1] == 0xda):
+		// zlib has no real magic number; these are the headers written
+		// with a 32K window at each compression level.
+		return Zlib
+	}
+	return Uncompressed
+}
+
+// Decompress sniffs the magic bytes of r and, if they name a known
+// compression format, returns a reader of the decompressed content.
+// Uncompressed input is passed through unchanged. Corrupt streams surface as
+// errors from the returned reader.
+func Decompress(r io.Reader) (io.Reader, Compression, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, Uncompressed, err
+	}
+
+	kind := DetectCompression(head)
+	switch kind {
+	case Gzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		return zr, kind, nil
+	case Bzip2:
+		return bzip2.NewReader(br), kind, nil
+	case Zlib:
+		if !looksLikeZlib(br) {
+			return br, Uncompressed, nil
+		}
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		return zr, kind, nil
+	case LZW:
+		zr, err := newUnLZW(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		return zr, kind, nil
+	}
+	return br, Uncompressed, nil
+}
+
+// looksLikeZlib guards against text that happens to start with a zlib header
+// ("x^...") by test-inflating the buffered prefix.
+func looksLikeZlib(br *bufio.Reader) bool {
+	head, _ := br.Peek(br.Size())
+	zr, err := zlib.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, zr)
+	return err == nil || err == io.ErrUnexpectedEOF
+}
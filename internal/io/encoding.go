@@ -0,0 +1,223 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the text encoding of an input.
+type Encoding int
+
+const (
+	// EncodingAuto honours a byte order mark and otherwise assumes UTF-8.
+	EncodingAuto Encoding = iota
+	UTF8
+	UTF16LE
+	UTF16BE
+	Latin1
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// ParseEncoding parses an --encoding name.
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "", "auto":
+		return EncodingAuto, nil
+	case "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16", "utf-16le", "utf16le":
+		return UTF16LE, nil
+	case "utf-16be", "utf16be":
+		return UTF16BE, nil
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		return Latin1, nil
+	}
+	return 0, fmt.Errorf("unsupported encoding %q", name)
+}
+
+// HasBOM reports whether data starts with a UTF-8 or UTF-16 byte order mark.
+func HasBOM(data []byte) bool {
+	return bytes.HasPrefix(data, bomUTF8) || bytes.HasPrefix(data, bomUTF16LE) || bytes.HasPrefix(data, bomUTF16BE)
+}
+
+// offsetMapper is implemented by readers whose output offsets differ from
+// the offsets of the input they read.
+type offsetMapper interface {
+	// SourceOffset maps the offset of a line start in the output back to
+	// the input. Offsets must be asked for in increasing order.
+	SourceOffset(off int64) int64
+}
+
+// Transcode returns a reader of r's content as UTF-8. A byte order mark
+// picks the encoding when enc is EncodingAuto and is stripped in any case.
+// LineReader offsets over the returned reader still refer to r.
+func Transcode(r io.Reader, enc Encoding) (io.Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	head, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var bom []byte
+	switch {
+	case bytes.HasPrefix(head, bomUTF8) && (enc == EncodingAuto || enc == UTF8):
+		enc, bom = UTF8, bomUTF8
+	case bytes.HasPrefix(head, bomUTF16LE) && (enc == EncodingAuto || enc == UTF16LE):
+		enc, bom = UTF16LE, bomUTF16LE
+	case bytes.HasPrefix(head, bomUTF16BE) && (enc == EncodingAuto || enc == UTF16BE):
+		enc, bom = UTF16BE, bomUTF16BE
+	}
+	br.Discard(len(bom))
+
+	if enc == EncodingAuto || enc == UTF8 {
+		if bom == nil {
+			return br, nil
+		}
+		return &shiftedReader{Reader: br, shift: int64(len(bom))}, nil
+	}
+	return &transcoder{r: br, enc: enc, src: int64(len(bom)), start: int64(len(bom))}, nil
+}
+
+// Reread returns a reader of data, all of what was read from r, whose
+// LineReader offsets refer to the input of r as those over r do.
+func Reread(r io.Reader, data []byte) io.Reader {
+	m, ok := r.(offsetMapper)
+	if !ok {
+		return bytes.NewReader(data)
+	}
+	return &rereader{bytes.NewReader(data), m}
+}
+
+type rereader struct {
+	*bytes.Reader
+	offsetMapper
+}
+
+// shiftedReader passes UTF-8 through after a stripped byte order mark.
+type shiftedReader struct {
+	io.Reader
+	shift int64
+}
+
+func (s *shiftedReader) SourceOffset(off int64) int64 {
+	return off + s.shift
+}
+
+// lineMark pairs the output and input offsets just past a newline.
+type lineMark struct {
+	dst, src int64
+}
+
+// transcoder decodes UTF-16 or Latin-1 into UTF-8, remembering where each
+// line starts in the input.
+type transcoder struct {
+	r     *bufio.Reader
+	enc   Encoding
+	src   int64 // input bytes consumed
+	dst   int64 // output bytes produced
+	start int64 // input offset of the first output byte
+	marks []lineMark
+	buf   []byte
+	err   error
+}
+
+func (t *transcoder) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		t.decode(4096)
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+// decode converts up to max input characters into t.buf.
+func (t *transcoder) decode(max int) {
+	t.buf = t.buf[:0]
+	for i := 0; i < max; i++ {
+		r, size, err := t.next()
+		if err != nil {
+			t.err = err
+			return
+		}
+		t.src += int64(size)
+		n := len(t.buf)
+		t.buf = utf8.AppendRune(t.buf, r)
+		t.dst += int64(len(t.buf) - n)
+		if r == '\n' {
+			t.marks = append(t.marks, lineMark{dst: t.dst, src: t.src})
+		}
+	}
+}
+
+// next reads one character from the input.
+func (t *transcoder) next() (rune, int, error) {
+	if t.enc == Latin1 {
+		b, err := t.r.ReadByte()
+		return rune(b), 1, err
+	}
+
+	u, err := t.unit()
+	if err != nil {
+		return 0, 0, err
+	}
+	if !utf16.IsSurrogate(rune(u)) {
+		return rune(u), 2, nil
+	}
+	if peek, err := t.r.Peek(2); err == nil {
+		low := t.order(peek)
+		if r := utf16.DecodeRune(rune(u), rune(low)); r != utf8.RuneError {
+			t.r.Discard(2)
+			return r, 4, nil
+		}
+	}
+	return utf8.RuneError, 2, nil
+}
+
+func (t *transcoder) unit() (uint16, error) {
+	var b [2]byte
+	n, err := io.ReadFull(t.r, b[:])
+	switch {
+	case n == 1:
+		// A dangling odd byte at the end.
+		return utf8.RuneError, nil
+	case err != nil:
+		return 0, err
+	}
+	return t.order(b[:]), nil
+}
+
+func (t *transcoder) order(b []byte) uint16 {
+	if t.enc == UTF16BE {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+func (t *transcoder) SourceOffset(off int64) int64 {
+	if off == 0 {
+		return t.start
+	}
+	for len(t.marks) > 0 && t.marks[0].dst < off {
+		t.marks = t.marks[1:]
+	}
+	if len(t.marks) > 0 && t.marks[0].dst == off {
+		return t.marks[0].src
+	}
+	return off
+}
@@ -2,10 +2,160 @@
 package io
 
 import (
-    "bufio"
-    "os"
+	"bytes"
+	"io"
+	"unicode/utf8"
 )
 
-func ReadLines(reader *os.File) (*bufio.Scanner, error) {
-    return bufio.NewScanner(reader), nil
-}
\ No newline at end of file
+// initialBufferSize is the starting size of a LineReader buffer. It only grows
+// when a single line does not fit.
+const initialBufferSize = 64 * 1024
+
+// LineReader reads newline-terminated lines of any length. Unlike
+// bufio.Scanner it has no token limit: the buffer is refilled in place and
+// doubled only when one line outgrows it, then kept for later lines and,
+// through Reset, later inputs.
+type LineReader struct {
+	r     io.Reader
+	buf   []byte
+	start int   // first unread byte in buf
+	end   int   // end of valid data in buf
+	base  int64 // input offset of buf[0]
+	eof   bool
+	err   error
+
+	line   []byte
+	offset int64
+	mapper offsetMapper
+}
+
+// ReadLines returns a LineReader over reader.
+func ReadLines(reader io.Reader) (*LineReader, error) {
+	return NewLineReader(reader), nil
+}
+
+// NewLineReader returns a LineReader over r.
+func NewLineReader(r io.Reader) *LineReader {
+	lr := &LineReader{buf: make([]byte, initialBufferSize)}
+	lr.Reset(r)
+	return lr
+}
+
+// Reset discards any buffered data and switches to reading from r, keeping
+// the buffer.
+func (lr *LineReader) Reset(r io.Reader) {
+	lr.r = r
+	lr.start, lr.end = 0, 0
+	lr.base = 0
+	lr.eof = false
+	lr.err = nil
+	lr.line = nil
+	lr.offset = 0
+	lr.mapper, _ = r.(offsetMapper)
+}
+
+// Next advances to the next line, which is then available through Line. It
+// returns false at the end of the input or on a read error.
+func (lr *LineReader) Next() bool {
+	for {
+		if i := bytes.IndexByte(lr.buf[lr.start:lr.end], '\n'); i >= 0 {
+			lr.emit(lr.start + i)
+			lr.start += i + 1
+			return true
+		}
+		if lr.eof || lr.err != nil {
+			if lr.start < lr.end {
+				// Final line without a trailing newline.
+				lr.emit(lr.end)
+				lr.start = lr.end
+				return true
+			}
+			lr.line = nil
+			return false
+		}
+		lr.fill()
+	}
+}
+
+func (lr *LineReader) emit(end int) {
+	lr.line = lr.buf[lr.start:end]
+	lr.offset = lr.base + int64(lr.start)
+}
+
+// fill reads more input, first sliding the unread bytes to the front of the
+// buffer and doubling it if they already fill it.
+func (lr *LineReader) fill() {
+	if lr.start > 0 {
+		copy(lr.buf, lr.buf[lr.start:lr.end])
+		lr.end -= lr.start
+		lr.base += int64(lr.start)
+		lr.start = 0
+	}
+	if lr.end == len(lr.buf) {
+		grown := make([]byte, 2*len(lr.buf))
+		copy(grown, lr.buf[:lr.end])
+		lr.buf = grown
+	}
+
+	n, err := lr.r.Read(lr.buf[lr.end:])
+	lr.end += n
+	if err == io.EOF {
+		lr.eof = true
+	} else if err != nil {
+		lr.err = err
+	}
+}
+
+// Peek returns the unread input without consuming it, reading the first
+// buffer if nothing has been read yet.
+func (lr *LineReader) Peek() []byte {
+	if lr.start == lr.end && !lr.eof && lr.err == nil {
+		lr.fill()
+	}
+	return lr.buf[lr.start:lr.end]
+}
+
+// Line returns the current line without its newline. The slice aliases the
+// reader's buffer and is only valid until the next call to Next.
+func (lr *LineReader) Line() []byte {
+	return lr.line
+}
+
+// Offset returns the byte offset of the start of the current line in the
+// input. For a reader returned by Transcode this is the offset in the
+// original, undecoded input.
+func (lr *LineReader) Offset() int64 {
+	if lr.mapper != nil {
+		return lr.mapper.SourceOffset(lr.offset)
+	}
+	return lr.offset
+}
+
+// TextOffset returns the byte offset of the start of the current line in
+// the text read, which for a reader returned by Transcode is the decoded
+// text rather than the input.
+func (lr *LineReader) TextOffset() int64 {
+	return lr.offset
+}
+
+// Err returns the first read error encountered, if any.
+func (lr *LineReader) Err() error {
+	return lr.err
+}
+
+// IsBinary reports whether data looks like binary rather than text: it
+// contains a NUL byte or is not valid UTF-8. A multi-byte character cut off
+// at the end of data does not count.
+func IsBinary(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return len(data) >= utf8.UTFMax || utf8.FullRune(data)
+		}
+		data = data[size:]
+	}
+	return false
+}
@@ -0,0 +1,6 @@
+package io
+
+import "errors"
+
+// errNotMappable is returned by Mmap for inputs that must be read normally.
+var errNotMappable = errors.New("file cannot be memory-mapped")
@@ -0,0 +1,27 @@
+//go:build linux
+
+package io
+
+import (
+	"os"
+	"syscall"
+)
+
+// Mmap maps f read-only into memory and returns the mapping with a function
+// that releases it. It fails for anything but a regular file of at least
+// minSize bytes, in which case the caller should read f normally.
+func Mmap(f *os.File, minSize int64) ([]byte, func() error, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() < minSize || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil, nil, errNotMappable
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package io
+
+import "os"
+
+// Mmap is only implemented on Linux; elsewhere callers fall back to
+// buffered reads.
+func Mmap(f *os.File, minSize int64) ([]byte, func() error, error) {
+	return nil, nil, errNotMappable
+}
@@ -0,0 +1,198 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The standard library's compress/lzw speaks the GIF/TIFF dialect, which
+// differs from Unix compress in its reserved codes and in how code widths
+// grow, so .Z files get this small decoder instead.
+
+const (
+	lzwInitBits = 9
+	lzwClear    = 256
+	lzwBlock    = 0x80
+	lzwBitsMask = 0x1f
+)
+
+var errCorruptLZW = errors.New("compress: corrupt input")
+
+// unLZW decompresses a Unix compress (.Z) stream.
+type unLZW struct {
+	r     io.ByteReader
+	block bool
+
+	maxBits, nBits int
+	maxCode        int
+	maxMaxCode     int
+	freeEnt        int
+	oldCode        int
+	finChar        byte
+	prefix         []uint16
+	suffix         []byte
+
+	bits      uint64
+	nbits     uint
+	groupBits int // bits read since codes last changed width
+
+	stack   []byte
+	pending []byte
+	err     error
+}
+
+func newUnLZW(r io.ByteReader) (*unLZW, error) {
+	var hdr [3]byte
+	for i := range hdr {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, errCorruptLZW
+		}
+		hdr[i] = c
+	}
+	maxBits := int(hdr[2] & lzwBitsMask)
+	if maxBits < lzwInitBits || maxBits > 16 {
+		return nil, fmt.Errorf("compress: unsupported code width %d", maxBits)
+	}
+
+	z := &unLZW{
+		r:          r,
+		block:      hdr[2]&lzwBlock != 0,
+		maxBits:    maxBits,
+		nBits:      lzwInitBits,
+		maxCode:    1<<lzwInitBits - 1,
+		maxMaxCode: 1 << maxBits,
+		oldCode:    -1,
+		prefix:     make([]uint16, 1<<maxBits),
+		suffix:     make([]byte, 1<<maxBits),
+	}
+	z.freeEnt = 256
+	if z.block {
+		z.freeEnt = lzwClear + 1
+	}
+	for i := 0; i < 256; i++ {
+		z.suffix[i] = byte(i)
+	}
+	return z, nil
+}
+
+func (z *unLZW) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.step()
+	}
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+// readCode reads the next nBits-wide code, LSB first. ok is false at the end
+// of the input.
+func (z *unLZW) readCode() (code int, ok bool) {
+	for z.nbits < uint(z.nBits) {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			if err != io.EOF {
+				z.err = err
+			}
+			return 0, false
+		}
+		z.bits |= uint64(c) << z.nbits
+		z.nbits += 8
+	}
+	code = int(z.bits & (1<<uint(z.nBits) - 1))
+	z.bits >>= uint(z.nBits)
+	z.nbits -= uint(z.nBits)
+	z.groupBits += z.nBits
+	return code, true
+}
+
+// skipGroup discards the rest of the current group of eight codes. compress
+// writes codes in such groups and pads the last one whenever the code width
+// changes.
+func (z *unLZW) skipGroup() {
+	group := z.nBits * 8
+	skip := (group - z.groupBits%group) % group
+	for ; skip > 0; skip-- {
+		if z.nbits == 0 {
+			c, err := z.r.ReadByte()
+			if err != nil {
+				return
+			}
+			z.bits, z.nbits = uint64(c), 8
+		}
+		z.bits >>= 1
+		z.nbits--
+	}
+	z.groupBits = 0
+}
+
+// step decodes one code into z.pending, or sets z.err.
+func (z *unLZW) step() {
+	if z.freeEnt > z.maxCode {
+		z.skipGroup()
+		z.nBits++
+		if z.nBits == z.maxBits {
+			z.maxCode = z.maxMaxCode
+		} else {
+			z.maxCode = 1<<z.nBits - 1
+		}
+	}
+
+	code, ok := z.readCode()
+	if !ok {
+		if z.err == nil {
+			z.err = io.EOF
+		}
+		return
+	}
+
+	if z.oldCode < 0 {
+		if code >= 256 {
+			z.err = errCorruptLZW
+			return
+		}
+		z.oldCode, z.finChar = code, byte(code)
+		z.pending = append(z.pending[:0], z.finChar)
+		return
+	}
+	if code == lzwClear && z.block {
+		z.skipGroup()
+		z.freeEnt = lzwClear
+		z.nBits = lzwInitBits
+		z.maxCode = 1<<lzwInitBits - 1
+		return
+	}
+
+	inCode := code
+	z.stack = z.stack[:0]
+	if code >= z.freeEnt {
+		if code > z.freeEnt {
+			z.err = errCorruptLZW
+			return
+		}
+		z.stack = append(z.stack, z.finChar)
+		code = z.oldCode
+	}
+	for code >= 256 {
+		z.stack = append(z.stack, z.suffix[code])
+		code = int(z.prefix[code])
+	}
+	z.finChar = byte(code)
+	z.stack = append(z.stack, z.finChar)
+
+	z.pending = z.pending[:0]
+	for i := len(z.stack) - 1; i >= 0; i-- {
+		z.pending = append(z.pending, z.stack[i])
+	}
+
+	if z.freeEnt < z.maxMaxCode {
+		z.prefix[z.freeEnt] = uint16(z.oldCode)
+		z.suffix[z.freeEnt] = z.finChar
+		z.freeEnt++
+	}
+	z.oldCode = inCode
+}
@@ -0,0 +1,221 @@
+package lang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// ParseGo parses a Go source file into the pkg syntax types, with positions
+// in fset. Identifiers are resolved to objects as go/parser does, within the
+// file: references to objects declared elsewhere are in File.Unresolved.
+func ParseGo(fset *token.FileSet, filename string, src []byte) (*pkg.File, error) {
+	af, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	c := converter{
+		idents:   make(map[*ast.Ident]*pkg.Ident),
+		byPos:    make(map[token.Pos]*pkg.Ident),
+		objects:  make(map[*ast.Object]*pkg.Object),
+		decls:    make(map[any]pkg.Decl),
+		comments: make(map[*ast.CommentGroup]*pkg.CommentGroup),
+	}
+	return c.file(af), nil
+}
+
+// converter translates a go/ast file, keeping each node it converted so
+// that shared nodes stay shared.
+type converter struct {
+	idents   map[*ast.Ident]*pkg.Ident
+	byPos    map[token.Pos]*pkg.Ident
+	objects  map[*ast.Object]*pkg.Object
+	decls    map[any]pkg.Decl // *ast.FuncDecl, *ast.ValueSpec or *ast.TypeSpec
+	comments map[*ast.CommentGroup]*pkg.CommentGroup
+}
+
+func (c *converter) file(af *ast.File) *pkg.File {
+	f := &pkg.File{Package: af.Package}
+	for _, cg := range af.Comments {
+		f.Comments = append(f.Comments, c.commentGroup(cg))
+	}
+	var selectors []*ast.Ident
+	ast.Inspect(af, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			selectors = append(selectors, n.Sel)
+		case *ast.Ident:
+			id := &pkg.Ident{NamePos: n.NamePos, Name: n.Name}
+			c.idents[n] = id
+			c.byPos[n.NamePos] = id
+			f.Idents = append(f.Idents, id)
+		case *ast.BasicLit:
+			f.Lits = append(f.Lits, &pkg.BasicLit{ValuePos: n.ValuePos, Kind: n.Kind, Value: n.Value})
+		}
+		return true
+	})
+	sort.Slice(f.Idents, func(i, j int) bool { return f.Idents[i].NamePos < f.Idents[j].NamePos })
+	sort.Slice(f.Lits, func(i, j int) bool { return f.Lits[i].ValuePos < f.Lits[j].ValuePos })
+	for _, n := range selectors {
+		f.Selectors = append(f.Selectors, c.idents[n])
+	}
+	sort.Slice(f.Selectors, func(i, j int) bool { return f.Selectors[i].NamePos < f.Selectors[j].NamePos })
+	f.Name = c.idents[af.Name]
+
+	for _, d := range af.Decls {
+		f.Decls = append(f.Decls, c.decl(d))
+	}
+	for _, spec := range af.Imports {
+		is := &pkg.ImportSpec{
+			Doc:     c.commentGroup(spec.Doc),
+			Path:    &pkg.BasicLit{ValuePos: spec.Path.ValuePos, Kind: spec.Path.Kind, Value: spec.Path.Value},
+			Comment: c.commentGroup(spec.Comment),
+			EndPos:  spec.End(),
+		}
+		if spec.Name != nil {
+			is.Name = c.idents[spec.Name]
+		}
+		f.Imports = append(f.Imports, is)
+	}
+
+	// Objects refer to declarations, so they are converted last.
+	for n, id := range c.idents {
+		if n.Obj != nil {
+			id.Obj = c.object(n.Obj)
+		}
+	}
+	if af.Scope != nil {
+		f.Scope = &pkg.Scope{Objects: make(map[string]*pkg.Object, len(af.Scope.Objects))}
+		for name, obj := range af.Scope.Objects {
+			f.Scope.Objects[name] = c.object(obj)
+		}
+	}
+	for _, n := range af.Unresolved {
+		f.Unresolved = append(f.Unresolved, c.idents[n])
+	}
+	return f
+}
+
+func (c *converter) decl(d ast.Decl) pkg.Decl {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		fd := &pkg.FuncDecl{Doc: c.commentGroup(d.Doc), Func: d.Type.Func, Name: c.idents[d.Name], EndPos: d.End()}
+		if d.Recv != nil && len(d.Recv.List) == 1 {
+			fd.Recv = c.idents[recvType(d.Recv.List[0].Type)]
+		}
+		c.decls[d] = fd
+		return fd
+	case *ast.GenDecl:
+		gd := &pkg.GenDecl{Doc: c.commentGroup(d.Doc), TokPos: d.TokPos, Tok: d.Tok, EndPos: d.End()}
+		for _, spec := range d.Specs {
+			c.decls[spec] = gd
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					gd.Names = append(gd.Names, c.idents[name])
+				}
+			case *ast.TypeSpec:
+				gd.Names = append(gd.Names, c.idents[spec.Name])
+			case *ast.ImportSpec:
+				if spec.Name != nil {
+					gd.Names = append(gd.Names, c.idents[spec.Name])
+				}
+			}
+		}
+		return gd
+	}
+	// *ast.BadDecl: the file did not parse, which ParseGo reports instead.
+	return nil
+}
+
+// recvType returns the base type name of a receiver type such as *T or
+// T[K], or nil if it has none.
+func recvType(x ast.Expr) *ast.Ident {
+	for {
+		switch t := x.(type) {
+		case *ast.Ident:
+			return t
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *converter) object(o *ast.Object) *pkg.Object {
+	if obj, ok := c.objects[o]; ok {
+		return obj
+	}
+	obj := &pkg.Object{Kind: pkg.ObjKind(o.Kind), Name: o.Name}
+	c.objects[o] = obj
+	if d, ok := c.decls[o.Decl]; ok {
+		obj.Decl = d
+	} else if id, ok := c.byPos[o.Pos()]; ok {
+		obj.Decl = id
+	}
+	return obj
+}
+
+func (c *converter) commentGroup(cg *ast.CommentGroup) *pkg.CommentGroup {
+	if cg == nil {
+		return nil
+	}
+	if g, ok := c.comments[cg]; ok {
+		return g
+	}
+	g := &pkg.CommentGroup{}
+	for _, cm := range cg.List {
+		g.List = append(g.List, &pkg.Comment{Slash: cm.Slash, Text: cm.Text})
+	}
+	c.comments[cg] = g
+	return g
+}
+
+// goRegions parses src as Go and returns its regions of the given kinds.
+func goRegions(src []byte, kinds Kind) ([]Span, error) {
+	fset := token.NewFileSet()
+	f, err := ParseGo(fset, "", src)
+	if err != nil {
+		return nil, err
+	}
+	base := fset.File(f.Package).Base()
+	var spans []Span
+	add := func(n pkg.Node, kind Kind) {
+		spans = append(spans, Span{int(n.Pos()) - base, int(n.End()) - base, kind})
+	}
+	if kinds&Comments != 0 {
+		for _, cg := range f.Comments {
+			for _, cm := range cg.List {
+				add(cm, Comments)
+			}
+		}
+	}
+	if kinds&Strings != 0 {
+		for _, lit := range f.Lits {
+			if lit.Kind == token.STRING {
+				add(lit, Strings)
+			}
+		}
+	}
+	if kinds&Idents != 0 {
+		for _, id := range f.Idents {
+			add(id, Idents)
+		}
+	}
+	if kinds&Imports != 0 {
+		for _, spec := range f.Imports {
+			add(spec.Path, Imports)
+		}
+	}
+	return spans, nil
+}
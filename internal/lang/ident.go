@@ -0,0 +1,131 @@
+package lang
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+var objKindNames = map[string]pkg.ObjKind{
+	"const": pkg.Con,
+	"type":  pkg.Typ,
+	"var":   pkg.Var,
+	"func":  pkg.Fun,
+}
+
+// ParseObjKinds parses a list of object kinds separated by | or commas, as
+// given to --kind: const, type, var and func.
+func ParseObjKinds(s string) ([]pkg.ObjKind, error) {
+	var kinds []pkg.ObjKind
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		kind, ok := objKindNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown object kind %q", name)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// IdentRegions parses src as Go and returns the identifiers that declare or
+// refer to the object named name, as Idents spans, if it is of one of kinds
+// or kinds is empty. Objects are compared by identity, so a local that
+// shadows name is not its reference. The object is the one named name on
+// line if line is positive, else the package-level one, else the only one
+// the file declares; method declarations are objects of kind func.
+//
+// References to name that the file does not declare (File.Unresolved) and
+// selected names such as x.Name (File.Selectors), whose object depends on
+// the type of x, are returned as Unresolved spans when kinds allows fields
+// or methods, that is vars or funcs, and the object is not a local.
+func IdentRegions(src []byte, name string, line int, kinds []pkg.ObjKind) ([]Span, error) {
+	fset := token.NewFileSet()
+	f, err := ParseGo(fset, "", src)
+	if err != nil {
+		return nil, err
+	}
+	base := fset.File(f.Package).Base()
+	var spans []Span
+	add := func(id *pkg.Ident, kind Kind) {
+		spans = append(spans, Span{int(id.Pos()) - base, int(id.End()) - base, kind})
+	}
+
+	// A method's name has no object; its declaring identifier stands for it.
+	var methods []*pkg.Ident
+	for _, d := range f.Decls {
+		if fd, ok := d.(*pkg.FuncDecl); ok && fd.Recv != nil && fd.Name.Name == name {
+			methods = append(methods, fd.Name)
+		}
+	}
+	obj, method, err := resolveIdent(fset, f, name, line, methods)
+	if err != nil {
+		return nil, err
+	}
+	allows := func(kind pkg.ObjKind) bool { return len(kinds) == 0 || slices.Contains(kinds, kind) }
+
+	switch {
+	case method != nil && allows(pkg.Fun):
+		add(method, Idents)
+	case obj != nil && allows(obj.Kind):
+		for _, id := range f.Idents {
+			if id.Obj == obj {
+				add(id, Idents)
+			}
+		}
+	}
+	local := obj != nil && f.Scope.Objects[name] != obj
+	if !local && (allows(pkg.Var) || allows(pkg.Fun)) {
+		for _, id := range f.Unresolved {
+			if id.Name == name {
+				add(id, Unresolved)
+			}
+		}
+		for _, id := range f.Selectors {
+			if id.Name == name {
+				add(id, Unresolved)
+			}
+		}
+	}
+	return normalize(spans), nil
+}
+
+// resolveIdent picks the object IdentRegions looks for: an object or the
+// name of one of methods, or neither if the file declares nothing named
+// name.
+func resolveIdent(fset *token.FileSet, f *pkg.File, name string, line int, methods []*pkg.Ident) (*pkg.Object, *pkg.Ident, error) {
+	if line > 0 {
+		for _, id := range methods {
+			if fset.Position(id.Pos()).Line == line {
+				return nil, id, nil
+			}
+		}
+		for _, id := range f.Idents {
+			if id.Name == name && id.Obj != nil && fset.Position(id.Pos()).Line == line {
+				return id.Obj, nil, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("no object named %s on line %d", name, line)
+	}
+	if obj := f.Scope.Objects[name]; obj != nil {
+		return obj, nil, nil
+	}
+
+	var objs []*pkg.Object
+	for _, id := range f.Idents {
+		if id.Name == name && id.Obj != nil && !slices.Contains(objs, id.Obj) {
+			objs = append(objs, id.Obj)
+		}
+	}
+	switch n := len(objs) + len(methods); {
+	case n > 1:
+		return nil, nil, fmt.Errorf("%d objects are named %s; pick one with %s:LINE", n, name, name)
+	case len(objs) == 1:
+		return objs[0], nil, nil
+	case len(methods) == 1:
+		return nil, methods[0], nil
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,168 @@
+// Package lang finds the syntactic regions of source files, such as
+// comments and string literals, so a search can be limited to them.
+package lang
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kind is a set of kinds of source regions.
+type Kind uint8
+
+const (
+	Comments Kind = 1 << iota
+	Strings       // string literals, quotes included
+	Idents        // identifiers
+	Imports       // import paths, quotes included
+	Code          // anything but comments and strings
+	// Unresolved marks references to names not declared in the file (see
+	// IdentRegions). It cannot be given to --only.
+	Unresolved
+)
+
+var kindNames = []struct {
+	kind Kind
+	name string
+}{
+	{Comments, "comments"},
+	{Strings, "strings"},
+	{Idents, "idents"},
+	{Imports, "imports"},
+	{Code, "code"},
+}
+
+// ParseKinds parses a comma-separated list of region kinds, as given to
+// --only.
+func ParseKinds(s string) (Kind, error) {
+	var kinds Kind
+	for _, name := range strings.Split(s, ",") {
+		i := 0
+		for i < len(kindNames) && kindNames[i].name != name {
+			i++
+		}
+		if i == len(kindNames) {
+			return 0, fmt.Errorf("unknown region kind %q", name)
+		}
+		kinds |= kindNames[i].kind
+	}
+	return kinds, nil
+}
+
+func (k Kind) String() string {
+	var names []string
+	for _, kn := range kindNames {
+		if k&kn.kind != 0 {
+			names = append(names, kn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Span is the region [Start, End) of a source file, as byte offsets.
+type Span struct {
+	Start, End int
+	Kind       Kind
+}
+
+// Languages lists the names accepted by Regions. Go is parsed; the others
+// are only lexed, so they have no Idents or Imports regions.
+var Languages = []string{"c", "go", "python", "shell", "sql", "yaml"}
+
+// extensions maps file name extensions to languages, for Detect.
+var extensions = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".sh":   "shell",
+	".bash": "shell",
+	".c":    "c",
+	".h":    "c",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".sql":  "sql",
+}
+
+// Detect returns the language of a file from its name, or "" if it is not
+// one Regions knows.
+func Detect(name string) string {
+	return extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// Regions returns the regions of src of the given kinds, sorted by offset
+// and not overlapping. Errors give positions as line:column.
+func Regions(language string, src []byte, kinds Kind) ([]Span, error) {
+	need := kinds
+	if kinds&Code != 0 {
+		need |= Comments | Strings
+	}
+	var spans []Span
+	if language == "go" {
+		var err error
+		if spans, err = goRegions(src, need); err != nil {
+			return nil, err
+		}
+	} else if syn := syntaxes[language]; syn != nil {
+		if other := kinds &^ (Comments | Strings | Code); other != 0 {
+			return nil, fmt.Errorf("%v regions are only known in Go", other)
+		}
+		spans = lex(src, syn)
+	} else {
+		return nil, fmt.Errorf("unsupported language %q", language)
+	}
+
+	spans = normalize(spans)
+	var out []Span
+	if kinds&Code != 0 {
+		out = code(spans, len(src))
+	}
+	for _, sp := range spans {
+		if sp.Kind&kinds != 0 {
+			out = append(out, sp)
+		}
+	}
+	return normalize(out), nil
+}
+
+// code returns the gaps between the comments and strings in spans, which
+// must be sorted, over a source of n bytes.
+func code(spans []Span, n int) []Span {
+	var out []Span
+	start := 0
+	for _, sp := range spans {
+		if sp.Kind&(Comments|Strings) == 0 {
+			continue
+		}
+		if sp.Start > start {
+			out = append(out, Span{start, sp.Start, Code})
+		}
+		start = max(start, sp.End)
+	}
+	if start < n {
+		out = append(out, Span{start, n, Code})
+	}
+	return out
+}
+
+// normalize sorts spans and merges the overlapping ones.
+func normalize(spans []Span) []Span {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	out := spans[:0]
+	for _, sp := range spans {
+		if n := len(out); n > 0 && sp.Start < out[n-1].End {
+			out[n-1].End = max(out[n-1].End, sp.End)
+			out[n-1].Kind |= sp.Kind
+			continue
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+// Contains reports whether [start, end) lies within one of spans, which
+// must be sorted and not overlapping.
+func Contains(spans []Span, start, end int) bool {
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].End > start })
+	return i < len(spans) && spans[i].Start <= start && end <= spans[i].End
+}
@@ -0,0 +1,170 @@
+package lang
+
+import "bytes"
+
+// syntax describes the comments and strings of a language for lex.
+type syntax struct {
+	lineComments  []string
+	blockComments [][2]string
+	// commentAfter, if set, holds the bytes that may come right before a
+	// line comment, which otherwise only starts a line.
+	commentAfter string
+	// quotes are tried in order, so longer delimiters come first.
+	quotes []quote
+	// quoteAfter is commentAfter for quotes.
+	quoteAfter string
+}
+
+// quote describes a kind of string literal.
+type quote struct {
+	open, close string
+	escape      byte // escapes the next byte; 0 for none
+	doubled     bool // a doubled close delimiter stands for itself
+	multiline   bool
+}
+
+// syntaxes holds the languages lex handles, by name.
+var syntaxes = map[string]*syntax{
+	"python": {
+		lineComments: []string{"#"},
+		quotes: []quote{
+			{open: `"""`, close: `"""`, escape: '\\', multiline: true},
+			{open: `'''`, close: `'''`, escape: '\\', multiline: true},
+			{open: `"`, close: `"`, escape: '\\'},
+			{open: `'`, close: `'`, escape: '\\'},
+		},
+	},
+	"shell": {
+		lineComments: []string{"#"},
+		commentAfter: " \t\n;|&(",
+		quotes: []quote{
+			{open: `"`, close: `"`, escape: '\\', multiline: true},
+			{open: `'`, close: `'`, multiline: true},
+		},
+	},
+	"c": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes: []quote{
+			{open: `"`, close: `"`, escape: '\\'},
+			{open: `'`, close: `'`, escape: '\\'},
+		},
+	},
+	"yaml": {
+		lineComments: []string{"#"},
+		commentAfter: " \t\n",
+		quotes: []quote{
+			{open: `"`, close: `"`, escape: '\\', multiline: true},
+			{open: `'`, close: `'`, doubled: true, multiline: true},
+		},
+		// Quotes start a scalar; elsewhere they are part of plain text.
+		quoteAfter: " \t\n:-[{,",
+	},
+	"sql": {
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes: []quote{
+			{open: `'`, close: `'`, doubled: true, multiline: true},
+		},
+	},
+}
+
+// lex returns the comments and strings of src, in order.
+func lex(src []byte, syn *syntax) []Span {
+	var spans []Span
+	starts := syn.starts()
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		if end, ok := syn.comment(src, i); ok {
+			spans = append(spans, Span{i, end, Comments})
+			i = end
+			continue
+		}
+		if afterAny(src, i, syn.quoteAfter) {
+			if end, ok := syn.string(src, i); ok {
+				spans = append(spans, Span{i, end, Strings})
+				i = end
+				continue
+			}
+		}
+		if j := bytes.IndexAny(rest[1:], starts); j >= 0 {
+			i += 1 + j
+		} else {
+			break
+		}
+	}
+	return spans
+}
+
+// starts returns the bytes that can open a comment or string.
+func (syn *syntax) starts() string {
+	var b []byte
+	for _, c := range syn.lineComments {
+		b = append(b, c[0])
+	}
+	for _, c := range syn.blockComments {
+		b = append(b, c[0][0])
+	}
+	for _, q := range syn.quotes {
+		b = append(b, q.open[0])
+	}
+	return string(b)
+}
+
+// comment returns the end of a comment starting at i, if there is one.
+func (syn *syntax) comment(src []byte, i int) (int, bool) {
+	rest := src[i:]
+	for _, c := range syn.blockComments {
+		if bytes.HasPrefix(rest, []byte(c[0])) {
+			if j := bytes.Index(rest[len(c[0]):], []byte(c[1])); j >= 0 {
+				return i + len(c[0]) + j + len(c[1]), true
+			}
+			return len(src), true
+		}
+	}
+	for _, c := range syn.lineComments {
+		if bytes.HasPrefix(rest, []byte(c)) && afterAny(src, i, syn.commentAfter) {
+			if j := bytes.IndexByte(rest, '\n'); j >= 0 {
+				return i + j, true
+			}
+			return len(src), true
+		}
+	}
+	return 0, false
+}
+
+// string returns the end of a string literal starting at i, if there is
+// one. An unterminated literal ends at the end of its line, or of src when
+// it may span lines.
+func (syn *syntax) string(src []byte, i int) (int, bool) {
+	for _, q := range syn.quotes {
+		if !bytes.HasPrefix(src[i:], []byte(q.open)) {
+			continue
+		}
+		j := i + len(q.open)
+		for j < len(src) {
+			switch {
+			case q.escape != 0 && src[j] == q.escape:
+				j += 2
+			case bytes.HasPrefix(src[j:], []byte(q.close)):
+				j += len(q.close)
+				if !q.doubled || !bytes.HasPrefix(src[j:], []byte(q.close)) {
+					return j, true
+				}
+				j += len(q.close)
+			case src[j] == '\n' && !q.multiline:
+				return j, true
+			default:
+				j++
+			}
+		}
+		return len(src), true
+	}
+	return 0, false
+}
+
+// afterAny reports whether position i starts src or follows one of the
+// bytes in set; an empty set allows any position.
+func afterAny(src []byte, i int, set string) bool {
+	return set == "" || i == 0 || bytes.IndexByte([]byte(set), src[i-1]) >= 0
+}
@@ -0,0 +1,64 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/compiler"
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+)
+
+// programCache is a directory of compiled programs, one file per key. The
+// zero value caches nothing.
+type programCache string
+
+func (dir programCache) path(key string) string {
+	return filepath.Join(string(dir), key+".prog")
+}
+
+// load returns the program stored under key if it is intact, of the current
+// format version and compiled from source with flags.
+func (dir programCache) load(key, source string, flags parser.Flags) *compiler.Program {
+	if dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(dir.path(key))
+	if err != nil {
+		return nil
+	}
+	var prog compiler.Program
+	if prog.UnmarshalBinary(data) != nil || prog.Pattern != source || prog.Flags != flags {
+		return nil
+	}
+	return &prog
+}
+
+// store saves prog under key. The file is written under a temporary name
+// and renamed into place, so concurrent runs sharing the directory never
+// read a partial program.
+func (dir programCache) store(key string, prog *compiler.Program) {
+	if dir == "" {
+		return
+	}
+	data, err := prog.MarshalBinary()
+	if err != nil || os.MkdirAll(string(dir), 0o755) != nil {
+		return
+	}
+	f, err := os.CreateTemp(string(dir), key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dir.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
@@ -3,15 +3,18 @@ package matcher
 
 import (
     "bytes"
-    "unicode"
+
+    "github.com/codecrafters-io/grep-starter-go/pkg"
 )
 
 type Matcher interface {
     Match(line []byte, pattern string) bool
 }
 
-type DigitMatcher struct{}
-type AlphanumericMatcher struct{}
+// DigitMatcher and AlphanumericMatcher share the class semantics of the
+// regex engine (see pkg.ClassID); ASCII selects the (?a) variants.
+type DigitMatcher struct{ ASCII bool }
+type AlphanumericMatcher struct{ ASCII bool }
 type PositiveCharGroupMatcher struct {}
 type NegativeCharGroupMatcher struct {}
 
@@ -44,32 +47,22 @@ func (pcgm PositiveCharGroupMatcher) Match(line []byte, pattern string) bool {
 }
 func (am AlphanumericMatcher) Match(line []byte, pattern string) bool {
     if pattern == "\\w" {
-        return containsAlphanumeric(line)
+        return containsClass(line, pkg.ClassWord, am.ASCII)
     }
     return bytes.Contains(line, []byte(pattern))
 }
 func (dm DigitMatcher) Match(line []byte, pattern string) bool {
     if pattern == "\\d" {
-        return containsDigit(line)
+        return containsClass(line, pkg.ClassDigit, dm.ASCII)
     }
     return bytes.Contains(line, []byte(pattern))
 }
 
-func containsDigit(line []byte) bool {
+func containsClass(line []byte, class pkg.ClassID, ascii bool) bool {
     for _, r := range string(line) {
-        if unicode.IsDigit(r) {
+        if class.Contains(r, ascii) {
             return true
         }
     }
     return false
 }
-
-func containsAlphanumeric(line []byte) bool {
-    for _, r := range string(line) {
-        if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
-            return true
-        }
-        
-    }
-    return false
-}
\ No newline at end of file
@@ -1,71 +1,267 @@
 package matcher
 
 import (
+	"bytes"
 	"fmt"
-	"regexp"
 	"strings"
-	"unicode/utf8"
+	"sync"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/compiler"
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
 )
 
+// Options tunes how a pattern is compiled.
+type Options struct {
+	// ASCII restricts \d, \w, \s, \b and \B to ASCII, as if the pattern
+	// started with (?a).
+	ASCII bool
+	// CacheDir, if set, is a directory of compiled programs keyed by
+	// compiler.Hash. A usable program found there is loaded instead of
+	// compiling the patterns, and a newly compiled one is saved. The cache
+	// is only an optimization: errors reading or writing it are ignored.
+	CacheDir string
+	// Limits bound each VM run (see pkg.Limits). A line on which a limit
+	// is exceeded does not match, and the error is kept for Err.
+	Limits pkg.Limits
+}
+
+// RegexMatcher runs a compiled pattern on the VM. It is safe for concurrent
+// use: each call borrows a VM from a pool, since a VM runs one program at a
+// time.
 type RegexMatcher struct {
-	pattern *regexp.Regexp
+	prog   *compiler.Program
+	limits pkg.Limits
+	vms    sync.Pool
+
+	mu  sync.Mutex
+	err error // first error from the VM
 }
 
 func NewRegexMatcher(pattern string) (*RegexMatcher, error) {
-	processedPattern := preprocessPattern(pattern)
-	
-	compiledPattern, err := regexp.Compile(processedPattern)
+	return NewRegexMatcherWithOptions(pattern, Options{})
+}
+
+// DumpProgram compiles pattern and returns the program as a pkg assembly
+// listing, each instruction annotated with the part of the pattern it came
+// from.
+func DumpProgram(pattern string, opts Options) (string, error) {
+	re, err := parse(pattern, opts)
+	if err != nil {
+		return "", err
+	}
+	c := compiler.GrepCompiler{KeepSpans: true}
+	prog, err := c.Compile(re)
+	if err != nil {
+		return "", fmt.Errorf("failed to compile regex: %v", err)
+	}
+	listing, err := pkg.Disassemble(prog.Code, prog.Comment)
+	if err != nil {
+		return "", err
+	}
+
+	header := fmt.Sprintf("; pattern %q\n; %d bytes, capturing groups: %d\n", pattern, len(prog.Code), prog.NumCap)
+	for i, name := range prog.Names {
+		if name != "" {
+			header += fmt.Sprintf("; group %d: %s\n", i, name)
+		}
+	}
+	if prog.Literal != "" {
+		header += fmt.Sprintf("; required literal %q\n", prog.Literal)
+	}
+	return header + listing, nil
+}
+
+func (opts Options) flags() parser.Flags {
+	var flags parser.Flags
+	if opts.ASCII {
+		flags |= parser.ASCII
+	}
+	return flags
+}
+
+func parse(pattern string, opts Options) (*parser.Regexp, error) {
+	re, err := parser.Parse(pattern, opts.flags())
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile regex: %v", err)
 	}
-	
-	return &RegexMatcher{pattern: compiledPattern}, nil
+	return re, nil
 }
 
-func (rm *RegexMatcher) Match(line []byte, _ string) bool {
-	return rm.pattern.Match(line)
+// NewRegexMatcherWithOptions parses and compiles pattern for the VM.
+func NewRegexMatcherWithOptions(pattern string, opts Options) (*RegexMatcher, error) {
+	return NewRegexMatcherPatterns([]string{pattern}, opts)
 }
 
-func preprocessPattern(pattern string) string {
-	if utf8.RuneCountInString(pattern) == 0 {
-		return pattern
+// NewRegexMatcherPatterns compiles patterns into one matcher that matches
+// wherever any of them does (see parser.Union). With Options.CacheDir set,
+// the compiled program is looked up in and saved to the cache.
+func NewRegexMatcherPatterns(patterns []string, opts Options) (*RegexMatcher, error) {
+	prog, err := compile(patterns, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	pattern = strings.ReplaceAll(pattern, "\\d", "[0-9]")
-	pattern = strings.ReplaceAll(pattern, "\\w", "[a-zA-Z0-9_]")
+	rm := &RegexMatcher{prog: prog, limits: opts.Limits}
+	vm, err := rm.newVM()
+	if err != nil {
+		return nil, err
+	}
+	rm.vms.Put(vm)
+	return rm, nil
+}
 
-	// Handle backreferences
-	groupRe := regexp.MustCompile(`\(([^)]*)\)`)
-	matches := groupRe.FindAllStringSubmatch(pattern, -1)
-	
-	if len(matches) != 0 {
-		for i, match := range matches {
-			pattern = strings.ReplaceAll(pattern, fmt.Sprintf("\\%d", i+1), match[1])
+// ParsePatterns parses patterns into the syntax tree that
+// NewRegexMatcherPatterns compiles.
+func ParsePatterns(patterns []string, opts Options) (*parser.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns")
+	}
+	res := make([]*parser.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := parser.Parse(pattern, opts.flags())
+		if err != nil {
+			if len(patterns) > 1 {
+				return nil, fmt.Errorf("failed to compile regex: pattern %d: %v", i+1, err)
+			}
+			return nil, fmt.Errorf("failed to compile regex: %v", err)
 		}
+		res[i] = re
+	}
+	re, err := parser.Union(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile regex: %v", err)
 	}
+	return re, nil
+}
 
-	// Handle nested backreferences
-	pattern = handleNestedBackreferences(pattern)
+func compile(patterns []string, opts Options) (*compiler.Program, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns")
+	}
+	cache := programCache(opts.CacheDir)
+	source := strings.Join(patterns, "\n")
+	flags := parser.PatternFlags(patterns[0], opts.flags())
+	key := compiler.Hash(source, flags)
+	if prog := cache.load(key, source, flags); prog != nil {
+		return prog, nil
+	}
+
+	re, err := ParsePatterns(patterns, opts)
+	if err != nil {
+		return nil, err
+	}
+	var c compiler.GrepCompiler
+	prog, err := c.Compile(re)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile regex: %v", err)
+	}
+	cache.store(key, prog)
+	return prog, nil
+}
 
-	return pattern
+func (rm *RegexMatcher) newVM() (*pkg.VM, error) {
+	vm := pkg.NewVM(len(rm.prog.Code))
+	if err := vm.LoadProgram(rm.prog.Code); err != nil {
+		return nil, fmt.Errorf("failed to load program: %v", err)
+	}
+	vm.SetLimits(rm.limits)
+	return vm, nil
+}
+
+// exec runs the program on input from pos on a pooled VM. An error is also
+// kept for Err.
+func (rm *RegexMatcher) exec(input []byte, pos int) ([]int, error) {
+	vm, _ := rm.vms.Get().(*pkg.VM)
+	if vm == nil {
+		var err error
+		if vm, err = rm.newVM(); err != nil {
+			// The program already loaded once in NewRegexMatcherWithOptions.
+			return nil, err
+		}
+	}
+	defer rm.vms.Put(vm)
+	caps, err := vm.Exec(input, pos)
+	if err != nil {
+		rm.mu.Lock()
+		if rm.err == nil {
+			rm.err = err
+		}
+		rm.mu.Unlock()
+		return nil, err
+	}
+	return caps, nil
 }
 
-func handleNestedBackreferences(pattern string) string {
-	stack := []int{}
-	result := []byte(pattern)
-	
-	for i := 0; i < len(result); i++ {
-		if result[i] == '(' {
-			stack = append(stack, i)
-		} else if result[i] == ')' && len(stack) > 0 {
-			start := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			
-			subPattern := string(result[start+1 : i])
-			subPattern = handleNestedBackreferences(subPattern)
-			copy(result[start+1:], []byte(subPattern))
+// Err returns the first error the VM met while matching, such as a
+// *pkg.LimitError, or nil. Calls that met an error reported no match.
+func (rm *RegexMatcher) Err() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.err
+}
+
+func (rm *RegexMatcher) Match(line []byte, _ string) bool {
+	caps, _ := rm.exec(line, 0)
+	return caps != nil
+}
+
+// FindIndex returns the bounds of the leftmost match in buf that starts at or
+// after from, or nil if there is none. buf may hold many lines; matches never
+// span a newline. When the pattern has a required literal only the lines
+// containing it are run through the VM.
+func (rm *RegexMatcher) FindIndex(buf []byte, from int) []int {
+	if caps := rm.find(buf, from); caps != nil {
+		return caps[:2]
+	}
+	return nil
+}
+
+// FindSubmatchIndex is FindIndex, also returning the bounds of each group:
+// group i is at [2i, 2i+1], which are -1 if it took no part in the match.
+func (rm *RegexMatcher) FindSubmatchIndex(buf []byte, from int) []int {
+	return rm.find(buf, from)
+}
+
+// SubexpNames returns the name of each group, "" for unnamed ones. Index 0
+// is the whole match.
+func (rm *RegexMatcher) SubexpNames() []string {
+	return rm.prog.Names
+}
+
+func (rm *RegexMatcher) find(buf []byte, from int) []int {
+	lit := rm.prog.Literal
+	for from <= len(buf) {
+		// The line to run through the VM: the one holding from, or with a
+		// literal the next one containing it. Running one line at a time
+		// keeps the VM's memo the size of a line rather than of buf.
+		i := from
+		if lit != "" {
+			j := bytes.Index(buf[from:], []byte(lit))
+			if j < 0 {
+				return nil
+			}
+			i += j
+		}
+		lineStart := bytes.LastIndexByte(buf[:i], '\n') + 1
+		end := len(buf)
+		if j := bytes.IndexByte(buf[i:], '\n'); j >= 0 {
+			end = i + j
+		}
+		start := lineStart
+		if start < from {
+			start = from
+		}
+		// A line that exceeds a limit has no match; go on after it.
+		if caps, _ := rm.exec(buf[lineStart:end], start-lineStart); caps != nil {
+			for i := range caps {
+				if caps[i] >= 0 {
+					caps[i] += lineStart
+				}
+			}
+			return caps
 		}
+		from = end + 1
 	}
-	
-	return string(result)
+	return nil
 }
@@ -0,0 +1,107 @@
+package matcher
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/compiler"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// TraceMatch runs pattern over line and writes every step of the VM to w:
+// each instruction with the input position it ran at and the part of the
+// pattern it came from, the alternatives left for backtracking, failed
+// threads, captures and the match. It reports whether line matched.
+func TraceMatch(pattern string, line []byte, opts Options, w io.Writer) (bool, error) {
+	re, err := parse(pattern, opts)
+	if err != nil {
+		return false, err
+	}
+	c := compiler.GrepCompiler{KeepSpans: true}
+	prog, err := c.Compile(re)
+	if err != nil {
+		return false, fmt.Errorf("failed to compile regex: %v", err)
+	}
+	vm := pkg.NewVM(len(prog.Code))
+	if err := vm.LoadProgram(prog.Code); err != nil {
+		return false, fmt.Errorf("failed to load program: %v", err)
+	}
+
+	t := &textTracer{w: w, prog: prog, input: line}
+	fmt.Fprintf(w, "; pattern %q\n; input %q\n", pattern, line)
+	vm.SetTracer(t)
+	caps, err := vm.Exec(line, 0)
+	if err == nil {
+		err = t.err
+	}
+	if err != nil {
+		return false, err
+	}
+	if caps == nil {
+		_, err = fmt.Fprintln(w, "no match")
+	}
+	return caps != nil, err
+}
+
+// textTracer writes VM events as text, one per line.
+type textTracer struct {
+	w     io.Writer
+	prog  *compiler.Program
+	input []byte
+	err   error // first write error
+}
+
+func (t *textTracer) printf(format string, args ...any) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintf(t.w, format, args...)
+	}
+}
+
+// at shows the input from pos, cut short.
+func (t *textTracer) at(pos int) string {
+	rest := t.input[pos:]
+	if len(rest) > 16 {
+		return strconv.Quote(string(rest[:16])) + "..."
+	}
+	return strconv.Quote(string(rest))
+}
+
+func (t *textTracer) Step(pc, pos int) {
+	text := pkg.FormatInstr(t.prog.Code, pc)
+	if c := t.prog.Comment(pc); c != "" {
+		text = fmt.Sprintf("%-28s ; %s", text, c)
+	}
+	text = fmt.Sprintf("%5d  %s", pc, text)
+	t.printf("pos %-4d %s\n", pos, text)
+}
+
+func (t *textTracer) Spawn(pc, pos int) {
+	t.printf("         spawn: retry pc %d at pos %d %s\n", pc, pos, t.at(pos))
+}
+
+func (t *textTracer) Kill(pc, pos int) {
+	t.printf("         fail at pc %d, pos %d %s\n", pc, pos, t.at(pos))
+}
+
+func (t *textTracer) Save(slot, pos int) {
+	if slot < 2*(t.prog.NumCap+1) {
+		t.printf("         group %d %s = %d\n", slot/2, [2]string{"start", "end"}[slot%2], pos)
+	}
+}
+
+func (t *textTracer) Match(caps []int) {
+	t.printf("match %q at %d-%d\n", t.input[caps[0]:caps[1]], caps[0], caps[1])
+	for i := 1; i <= t.prog.NumCap; i++ {
+		lo, hi := caps[2*i], caps[2*i+1]
+		name := strconv.Itoa(i)
+		if t.prog.Names[i] != "" {
+			name += " (" + t.prog.Names[i] + ")"
+		}
+		if lo < 0 || hi < lo {
+			t.printf("  group %s unset\n", name)
+			continue
+		}
+		t.printf("  group %s %q at %d-%d\n", name, t.input[lo:hi], lo, hi)
+	}
+}
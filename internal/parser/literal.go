@@ -0,0 +1,72 @@
+package parser
+
+import "strings"
+
+// literalInfo describes the text a node can match: exact is set when the
+// node always matches exactly text, and best is the longest string every
+// match of the node must contain.
+type literalInfo struct {
+	exact bool
+	text  string
+	best  string
+}
+
+// RequiredLiteral returns the longest string that every match of n must
+// contain, or "" if there is none. Searchers use it to skip input that
+// cannot match before running the full matcher.
+func RequiredLiteral(n *Node) string {
+	return literals(n).best
+}
+
+func literals(n *Node) literalInfo {
+	switch n.Op {
+	case OpLiteral:
+		s := string(n.Rune)
+		return literalInfo{exact: true, text: s, best: s}
+	case OpEmpty, OpBeginLine, OpEndLine, OpWordBoundary, OpNoWordBoundary, OpLookahead:
+		// Zero-width: the text around them is still contiguous.
+		return literalInfo{exact: true}
+	case OpCapture:
+		return literals(n.Subs[0])
+	case OpConcat:
+		var info literalInfo
+		var run strings.Builder
+		exact := true
+		for _, sub := range n.Subs {
+			si := literals(sub)
+			if si.exact {
+				run.WriteString(si.text)
+				info.best = longer(info.best, run.String())
+				continue
+			}
+			exact = false
+			info.best = longer(info.best, si.best)
+			run.Reset()
+		}
+		if exact {
+			info.exact, info.text = true, run.String()
+		}
+		return info
+	case OpRepeat:
+		if n.Min == 0 {
+			return literalInfo{}
+		}
+		si := literals(n.Subs[0])
+		if si.exact && n.Min == n.Max {
+			s := strings.Repeat(si.text, n.Min)
+			return literalInfo{exact: true, text: s, best: s}
+		}
+		if si.exact {
+			return literalInfo{best: strings.Repeat(si.text, n.Min)}
+		}
+		return literalInfo{best: si.best}
+	}
+	return literalInfo{}
+}
+
+func longer(a, b string) string {
+	if len(b) > len(a) {
+		return b
+	}
+	return a
+}
@@ -1 +1,572 @@
-package parser
\ No newline at end of file
+// internal/parser/parser.go
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// maxRepeat bounds the counts accepted in {n,m} so a pattern cannot blow up
+// the compiled program.
+const maxRepeat = 1000
+
+// Flags alter how a pattern is interpreted.
+type Flags uint8
+
+const (
+	// ASCII restricts \d, \w, \s, \b and \B to ASCII. It is set by a leading
+	// (?a) in the pattern or by the caller (--ascii).
+	ASCII Flags = 1 << iota
+)
+
+// Op identifies the kind of a syntax node.
+type Op uint8
+
+const (
+	OpEmpty          Op = iota + 1 // matches the empty string
+	OpLiteral                      // Rune
+	OpAnyChar                      // any character except newline
+	OpCharClass                    // Class
+	OpBeginLine                    // ^
+	OpEndLine                      // $
+	OpWordBoundary                 // \b
+	OpNoWordBoundary               // \B
+	OpCapture                      // (Subs[0]) as group Cap, optionally named
+	OpConcat                       // Subs in sequence
+	OpAlternate                    // one of Subs, leftmost first
+	OpRepeat                       // Subs[0] between Min and Max times (Max < 0: unbounded)
+	OpBackref                      // text previously captured by group Cap
+	OpLookahead                    // zero-width Subs[0], inverted when Negate is set
+)
+
+// Node is a node of the regex syntax tree. Pos and End delimit the source
+// text the node was parsed from, as byte offsets into the pattern.
+type Node struct {
+	Op       Op
+	Rune     rune
+	Class    *CharClass
+	Min, Max int
+	Greedy   bool
+	Negate   bool
+	Cap      int
+	Name     string
+	Subs     []*Node
+	Pos, End int
+}
+
+// RuneRange is an inclusive range of runes.
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// ClassRef is a shorthand class (\d, \W, ...) used inside a character class.
+type ClassRef struct {
+	ID     pkg.ClassID
+	Negate bool
+}
+
+// PropRef is a Unicode property (\p{Greek}, \PL, ...) used inside a
+// character class.
+type PropRef struct {
+	Name   string
+	Negate bool
+}
+
+// CharClass is a bracket expression or a shorthand escape. A rune matches
+// when it falls in any of the ranges, classes or properties, inverted when
+// Negate is set.
+type CharClass struct {
+	Negate  bool
+	Ranges  []RuneRange
+	Classes []ClassRef
+	Props   []PropRef
+}
+
+// Regexp is a parsed pattern.
+type Regexp struct {
+	Pattern string
+	Flags   Flags
+	Root    *Node
+	// NumCap is the number of capturing groups.
+	NumCap int
+	// Names holds the name of each capturing group; Names[0] is the whole match.
+	Names []string
+}
+
+// Error describes a syntax error in a pattern.
+type Error struct {
+	Msg     string
+	Pattern string
+	Pos     int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at offset %d in `%s`", e.Msg, e.Pos, e.Pattern)
+}
+
+type parser struct {
+	src      string
+	pos      int
+	flags    Flags
+	numCap   int
+	names    []string
+	backrefs []*Node
+}
+
+// Parse parses pattern into a syntax tree.
+func Parse(pattern string, flags Flags) (*Regexp, error) {
+	p := &parser{src: pattern, flags: PatternFlags(pattern, flags), names: []string{""}}
+	if strings.HasPrefix(pattern, "(?a)") {
+		p.pos = len("(?a)")
+	}
+
+	root, err := p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf(p.pos, "unexpected )")
+	}
+	for _, ref := range p.backrefs {
+		if ref.Cap > p.numCap {
+			return nil, p.errorf(ref.Pos, "invalid backreference \\%d", ref.Cap)
+		}
+	}
+
+	return &Regexp{
+		Pattern: pattern,
+		Flags:   p.flags,
+		Root:    root,
+		NumCap:  p.numCap,
+		Names:   p.names,
+	}, nil
+}
+
+// PatternFlags returns the flags Parse records for pattern parsed with flags:
+// these and any set by the pattern itself.
+func PatternFlags(pattern string, flags Flags) Flags {
+	if strings.HasPrefix(pattern, "(?a)") {
+		flags |= ASCII
+	}
+	return flags
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Msg: fmt.Sprintf(format, args...), Pattern: p.src, Pos: pos}
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *parser) parseAlternate() (*Node, error) {
+	start := p.pos
+	var subs []*Node
+	for {
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+		if !p.more() || p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(subs) == 1 {
+		return subs[0], nil
+	}
+	return &Node{Op: OpAlternate, Subs: subs, Pos: start, End: p.pos}, nil
+}
+
+func (p *parser) parseConcat() (*Node, error) {
+	start := p.pos
+	var subs []*Node
+	for p.more() && p.peek() != '|' && p.peek() != ')' {
+		n, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		n, err = p.parseRepeat(n)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		return &Node{Op: OpEmpty, Pos: start, End: p.pos}, nil
+	case 1:
+		return subs[0], nil
+	}
+	return &Node{Op: OpConcat, Subs: subs, Pos: start, End: p.pos}, nil
+}
+
+func (p *parser) parseAtom() (*Node, error) {
+	start := p.pos
+	c := p.peek()
+	switch c {
+	case '*', '+', '?':
+		return nil, p.errorf(start, "missing argument to repetition operator %c", c)
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '.':
+		p.pos++
+		return &Node{Op: OpAnyChar, Pos: start, End: p.pos}, nil
+	case '^':
+		p.pos++
+		return &Node{Op: OpBeginLine, Pos: start, End: p.pos}, nil
+	case '$':
+		p.pos++
+		return &Node{Op: OpEndLine, Pos: start, End: p.pos}, nil
+	case '\\':
+		return p.parseEscape()
+	case '{':
+		if _, _, ok := p.scanRepeat(); ok {
+			return nil, p.errorf(start, "missing argument to repetition operator {")
+		}
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return &Node{Op: OpLiteral, Rune: r, Pos: start, End: p.pos}, nil
+}
+
+func (p *parser) parseGroup() (*Node, error) {
+	start := p.pos
+	p.pos++ // (
+
+	node := &Node{Op: OpCapture, Pos: start}
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "?:"):
+		node.Op = 0
+		p.pos += 2
+	case strings.HasPrefix(rest, "?="), strings.HasPrefix(rest, "?!"):
+		node.Op = OpLookahead
+		node.Negate = rest[1] == '!'
+		p.pos += 2
+	case strings.HasPrefix(rest, "?P<"), strings.HasPrefix(rest, "?<"):
+		p.pos += strings.IndexByte(rest, '<') + 1
+		end := strings.IndexByte(p.src[p.pos:], '>')
+		if end < 0 {
+			return nil, p.errorf(start, "missing closing > in group name")
+		}
+		node.Name = p.src[p.pos : p.pos+end]
+		if !isGroupName(node.Name) {
+			return nil, p.errorf(p.pos, "invalid group name %q", node.Name)
+		}
+		p.pos += end + 1
+	case strings.HasPrefix(rest, "?"):
+		return nil, p.errorf(start, "invalid or unsupported group syntax")
+	}
+
+	if node.Op == OpCapture {
+		p.numCap++
+		node.Cap = p.numCap
+		p.names = append(p.names, node.Name)
+	}
+
+	sub, err := p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if !p.more() || p.peek() != ')' {
+		return nil, p.errorf(start, "missing closing )")
+	}
+	p.pos++
+
+	if node.Op == 0 {
+		return sub, nil
+	}
+	node.Subs = []*Node{sub}
+	node.End = p.pos
+	return node, nil
+}
+
+func isGroupName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanRepeat reports whether a well-formed {n}, {n,} or {n,m} quantifier
+// starts at the current position, without consuming it.
+func (p *parser) scanRepeat() (min, max int, ok bool) {
+	_, min, max, ok = p.repeatAt(p.pos)
+	return min, max, ok
+}
+
+// repeatAt parses the quantifier starting at pos and returns the offset just
+// past it, or ok == false if the text there is not a well-formed quantifier.
+func (p *parser) repeatAt(pos int) (end, min, max int, ok bool) {
+	rest := p.src[pos:]
+	closing := strings.IndexByte(rest, '}')
+	if len(rest) < 2 || rest[0] != '{' || closing < 0 {
+		return 0, 0, 0, false
+	}
+	lo, hi, hasComma := strings.Cut(rest[1:closing], ",")
+	if min, ok = parseCount(lo); !ok {
+		return 0, 0, 0, false
+	}
+	max = min
+	if hasComma {
+		max = -1
+		if hi != "" {
+			if max, ok = parseCount(hi); !ok {
+				return 0, 0, 0, false
+			}
+		}
+	}
+	return pos + closing + 1, min, max, true
+}
+
+func parseCount(s string) (int, bool) {
+	if s == "" || len(s) > 8 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+func (p *parser) parseRepeat(sub *Node) (*Node, error) {
+	if !p.more() {
+		return sub, nil
+	}
+	start := p.pos
+	var min, max int
+	switch p.peek() {
+	case '*':
+		min, max = 0, -1
+		p.pos++
+	case '+':
+		min, max = 1, -1
+		p.pos++
+	case '?':
+		min, max = 0, 1
+		p.pos++
+	case '{':
+		end, lo, hi, ok := p.repeatAt(p.pos)
+		if !ok {
+			if p.pos+1 < len(p.src) && (isDigit(p.src[p.pos+1]) || p.src[p.pos+1] == ',') {
+				return nil, p.errorf(start, "invalid repeat count")
+			}
+			return sub, nil
+		}
+		if lo > maxRepeat || hi > maxRepeat || (hi >= 0 && hi < lo) {
+			return nil, p.errorf(start, "invalid repeat count")
+		}
+		min, max = lo, hi
+		p.pos = end
+	default:
+		return sub, nil
+	}
+
+	greedy := true
+	if p.more() && p.peek() == '?' {
+		greedy = false
+		p.pos++
+	}
+	if p.more() {
+		if c := p.peek(); c == '*' || c == '+' || c == '?' {
+			return nil, p.errorf(p.pos, "invalid nested repetition operator")
+		}
+		if _, _, ok := p.scanRepeat(); ok {
+			return nil, p.errorf(p.pos, "invalid nested repetition operator")
+		}
+	}
+	return &Node{Op: OpRepeat, Min: min, Max: max, Greedy: greedy, Subs: []*Node{sub}, Pos: sub.Pos, End: p.pos}, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (p *parser) parseEscape() (*Node, error) {
+	start := p.pos
+	if p.pos+1 >= len(p.src) {
+		return nil, p.errorf(start, "trailing backslash at end of expression")
+	}
+	c := p.src[p.pos+1]
+	switch {
+	case c == 'b':
+		p.pos += 2
+		return &Node{Op: OpWordBoundary, Pos: start, End: p.pos}, nil
+	case c == 'B':
+		p.pos += 2
+		return &Node{Op: OpNoWordBoundary, Pos: start, End: p.pos}, nil
+	case '1' <= c && c <= '9':
+		p.pos += 2
+		n := &Node{Op: OpBackref, Cap: int(c - '0'), Pos: start, End: p.pos}
+		p.backrefs = append(p.backrefs, n)
+		return n, nil
+	}
+
+	class := &CharClass{}
+	r, isClass, err := p.parseClassEscape(class)
+	if err != nil {
+		return nil, err
+	}
+	if isClass {
+		return &Node{Op: OpCharClass, Class: class, Pos: start, End: p.pos}, nil
+	}
+	return &Node{Op: OpLiteral, Rune: r, Pos: start, End: p.pos}, nil
+}
+
+// parseClassEscape parses the escape at the current position. Shorthand
+// classes and Unicode properties are added to class and reported with
+// isClass set; anything else is returned as a literal rune.
+func (p *parser) parseClassEscape(class *CharClass) (r rune, isClass bool, err error) {
+	start := p.pos
+	if p.pos+1 >= len(p.src) {
+		return 0, false, p.errorf(start, "trailing backslash at end of expression")
+	}
+	c := p.src[p.pos+1]
+	p.pos += 2
+
+	switch c {
+	case 'd', 'D':
+		class.Classes = append(class.Classes, ClassRef{ID: pkg.ClassDigit, Negate: c == 'D'})
+		return 0, true, nil
+	case 'w', 'W':
+		class.Classes = append(class.Classes, ClassRef{ID: pkg.ClassWord, Negate: c == 'W'})
+		return 0, true, nil
+	case 's', 'S':
+		class.Classes = append(class.Classes, ClassRef{ID: pkg.ClassSpace, Negate: c == 'S'})
+		return 0, true, nil
+	case 'p', 'P':
+		name := ""
+		if p.more() && p.peek() == '{' {
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return 0, false, p.errorf(start, "missing closing } in Unicode property")
+			}
+			name = p.src[p.pos+1 : p.pos+end]
+			p.pos += end + 1
+		} else if p.more() {
+			name = p.src[p.pos : p.pos+1]
+			p.pos++
+		}
+		if pkg.UnicodeTable(name) == nil {
+			return 0, false, p.errorf(start, "invalid Unicode property %q", name)
+		}
+		class.Props = append(class.Props, PropRef{Name: name, Negate: c == 'P'})
+		return 0, true, nil
+	case 'n':
+		return '\n', false, nil
+	case 't':
+		return '\t', false, nil
+	case 'r':
+		return '\r', false, nil
+	case 'f':
+		return '\f', false, nil
+	case 'v':
+		return '\v', false, nil
+	case 'a':
+		return '\a', false, nil
+	case 'x':
+		return p.parseHexEscape(start)
+	}
+
+	if c < utf8.RuneSelf && !isDigit(c) && !unicode.IsLetter(rune(c)) {
+		return rune(c), false, nil
+	}
+	return 0, false, p.errorf(start, "invalid escape sequence \\%c", c)
+}
+
+func (p *parser) parseHexEscape(start int) (rune, bool, error) {
+	var digits string
+	if p.more() && p.peek() == '{' {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 {
+			return 0, false, p.errorf(start, "missing closing } in hex escape")
+		}
+		digits = p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else if p.pos+2 <= len(p.src) {
+		digits = p.src[p.pos : p.pos+2]
+		p.pos += 2
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || v > unicode.MaxRune {
+		return 0, false, p.errorf(start, "invalid hex escape")
+	}
+	return rune(v), false, nil
+}
+
+func (p *parser) parseClass() (*Node, error) {
+	start := p.pos
+	p.pos++ // [
+
+	class := &CharClass{}
+	if p.more() && p.peek() == '^' {
+		class.Negate = true
+		p.pos++
+	}
+
+	first := true
+	for {
+		if !p.more() {
+			return nil, p.errorf(start, "missing closing ]")
+		}
+		if p.peek() == ']' && !first {
+			p.pos++
+			break
+		}
+		first = false
+
+		lo, isClass, err := p.parseClassRune(class)
+		if err != nil {
+			return nil, err
+		}
+		if isClass {
+			continue
+		}
+		hi := lo
+		if p.pos+1 < len(p.src) && p.peek() == '-' && p.src[p.pos+1] != ']' {
+			rangeStart := p.pos
+			p.pos++
+			hi, isClass, err = p.parseClassRune(class)
+			if err != nil {
+				return nil, err
+			}
+			if isClass || hi < lo {
+				return nil, p.errorf(rangeStart, "invalid character class range")
+			}
+		}
+		class.Ranges = append(class.Ranges, RuneRange{Lo: lo, Hi: hi})
+	}
+
+	return &Node{Op: OpCharClass, Class: class, Pos: start, End: p.pos}, nil
+}
+
+func (p *parser) parseClassRune(class *CharClass) (rune, bool, error) {
+	if p.peek() == '\\' {
+		return p.parseClassEscape(class)
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return r, false, nil
+}
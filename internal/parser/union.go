@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Union combines patterns parsed separately into one that matches wherever
+// any of them does, preferring earlier ones. The patterns' groups are
+// renumbered in order, so a backreference still refers to a group of its own
+// pattern. The combined Pattern is the sources joined by newlines, and node
+// offsets point into it.
+func Union(res []*Regexp) (*Regexp, error) {
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	u := &Regexp{Root: &Node{Op: OpAlternate}, Names: []string{""}}
+	var src []string
+	offset := 0
+	for i, re := range res {
+		if i > 0 && re.Flags != u.Flags {
+			return nil, fmt.Errorf("pattern %d: (?a) must be given for every pattern or none", i+1)
+		}
+		u.Flags = re.Flags
+		shift(re.Root, u.NumCap, offset)
+		u.Root.Subs = append(u.Root.Subs, re.Root)
+		u.NumCap += re.NumCap
+		u.Names = append(u.Names, re.Names[1:]...)
+		src = append(src, re.Pattern)
+		offset += len(re.Pattern) + 1
+	}
+	u.Pattern = strings.Join(src, "\n")
+	u.Root.End = len(u.Pattern)
+	return u, nil
+}
+
+// shift renumbers the groups under n by caps and moves its offsets by pos.
+func shift(n *Node, caps, pos int) {
+	if n.Op == OpCapture || n.Op == OpBackref {
+		n.Cap += caps
+	}
+	n.Pos += pos
+	n.End += pos
+	for _, sub := range n.Subs {
+		shift(sub, caps, pos)
+	}
+}
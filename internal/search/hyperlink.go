@@ -0,0 +1,126 @@
+package search
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hyperlink is a parsed URL template for the OSC 8 terminal hyperlinks of
+// Options.Hyperlink. Text is copied as is and these fields are replaced:
+//
+//	{host}  the host name
+//	{path}  the absolute path of the file, slash-separated, starting with a
+//	        slash and escaped for a URL
+//	{line}  the line number
+//	{col}   the 1-based byte column of the line's first match, 1 for
+//	        context lines
+type Hyperlink struct {
+	parts []string // text and field names, alternating; fields are odd
+	host  string
+	col   bool // the template uses {col}
+}
+
+// DefaultHyperlink is the URL template of a local file.
+const DefaultHyperlink = "file://{host}{path}"
+
+// ParseHyperlink parses a hyperlink URL template.
+func ParseHyperlink(format string) (*Hyperlink, error) {
+	h := &Hyperlink{}
+	h.host, _ = os.Hostname()
+	rest := format
+	for {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			h.parts = append(h.parts, rest)
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("hyperlink format: unclosed { in %q", format)
+		}
+		field := rest[i+1 : i+j]
+		switch field {
+		case "host", "path", "line":
+		case "col":
+			h.col = true
+		default:
+			return nil, fmt.Errorf("hyperlink format: unknown field {%s}", field)
+		}
+		h.parts = append(h.parts, rest[:i], field)
+		rest = rest[i+j+1:]
+	}
+	if !strings.Contains(format, "{path}") {
+		return nil, fmt.Errorf("hyperlink format: %q has no {path}", format)
+	}
+	return h, nil
+}
+
+func (h *Hyperlink) url(path string, lineNum, col int) string {
+	var b strings.Builder
+	for i, p := range h.parts {
+		if i%2 == 0 {
+			b.WriteString(p)
+			continue
+		}
+		switch p {
+		case "host":
+			b.WriteString(h.host)
+		case "path":
+			b.WriteString(path)
+		case "line":
+			b.WriteString(strconv.Itoa(lineNum))
+		case "col":
+			b.WriteString(strconv.Itoa(col))
+		}
+	}
+	return b.String()
+}
+
+// linkPath returns the {path} of an input for Options.Hyperlink, or "" if
+// it gets no links: standard input, archive members, and paths that cannot
+// be made absolute.
+func (s *Searcher) linkPath(name string, depth int) string {
+	if s.opts.Hyperlink == nil || depth > 0 || name == StdinName {
+		return ""
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return ""
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		// A Windows drive letter.
+		abs = "/" + abs
+	}
+	return (&url.URL{Path: abs}).EscapedPath()
+}
+
+// lineURL returns the hyperlink of a line of an input, or "" for none.
+func (s *Searcher) lineURL(st *fileState, lineNum int, offset int64, line []byte, context bool) string {
+	if st.link == "" {
+		return ""
+	}
+	col := 1
+	if s.opts.Hyperlink.col && !context {
+		if locs := s.submatches(s.matcher, line); len(locs) > 0 {
+			col = locs[0][0] + 1
+		}
+	}
+	return s.opts.Hyperlink.url(st.link, lineNum, col)
+}
+
+// appendLink appends text, as an OSC 8 hyperlink to url unless url is "".
+func appendLink(b []byte, url, text string) []byte {
+	if url == "" {
+		return append(b, text...)
+	}
+	b = append(b, "\x1b]8;;"...)
+	b = append(b, url...)
+	b = append(b, "\x1b\\"...)
+	b = append(b, text...)
+	return append(b, "\x1b]8;;\x1b\\"...)
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// jsonEvent is a line of FormatJSON output, one of
+//
+//	{"type":"begin","data":{"path":P}}
+//	{"type":"match","data":{"path":P,"line_number":N,"absolute_offset":O,"line":T,"submatches":[{"match":T,"start":S,"end":E}]}}
+//	{"type":"context","data":{...as for match, with no submatches}}
+//	{"type":"end","data":{"path":P,"binary":B,"stats":{"matched_lines":N,"matches":M}}}
+//	{"type":"summary","data":{"stats":{"searched":N,"matched":N,"errored":N,"matched_lines":N,"matches":M}}}
+//
+// Begin and end are printed only around inputs with lines to report, or
+// whose match is reported without them because they are binary. Paths and
+// text (T) are {"text":S} when they are valid UTF-8 and {"bytes":B} with B
+// in standard base64 otherwise. Lines have no trailing newline; offsets are
+// in bytes, submatch bounds relative to the start of the line.
+type jsonEvent struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// jsonText is text that is printed as a string if it is valid UTF-8 and in
+// base64 otherwise.
+type jsonText []byte
+
+func (t jsonText) MarshalJSON() ([]byte, error) {
+	var v any = struct {
+		Bytes string `json:"bytes"`
+	}{base64.StdEncoding.EncodeToString(t)}
+	if utf8.Valid(t) {
+		v = struct {
+			Text string `json:"text"`
+		}{string(t)}
+	}
+	// As printEvent, leave <, > and & as they are.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+type jsonBegin struct {
+	Path jsonText `json:"path"`
+}
+
+type jsonLine struct {
+	Path           jsonText       `json:"path"`
+	LineNumber     int            `json:"line_number"`
+	AbsoluteOffset int64          `json:"absolute_offset"`
+	Line           jsonText       `json:"line"`
+	Submatches     []jsonSubmatch `json:"submatches"`
+}
+
+type jsonSubmatch struct {
+	Match jsonText `json:"match"`
+	Start int      `json:"start"`
+	End   int      `json:"end"`
+}
+
+type jsonEnd struct {
+	Path   jsonText `json:"path"`
+	Binary bool     `json:"binary"`
+	Stats  struct {
+		MatchedLines int `json:"matched_lines"`
+		Matches      int `json:"matches"`
+	} `json:"stats"`
+}
+
+type jsonSummary struct {
+	Stats struct {
+		Searched     int `json:"searched"`
+		Matched      int `json:"matched"`
+		Errored      int `json:"errored"`
+		MatchedLines int `json:"matched_lines"`
+		Matches      int `json:"matches"`
+	} `json:"stats"`
+}
+
+func (s *Searcher) printEvent(typ string, data any) error {
+	enc := json.NewEncoder(s.out)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(jsonEvent{typ, data})
+}
+
+// beginFile prints the begin event of an input once.
+func (s *Searcher) beginFile(st *fileState) error {
+	if st.begun {
+		return nil
+	}
+	st.begun = true
+	return s.printEvent("begin", jsonBegin{jsonText(st.name)})
+}
+
+// endFile adds the counts of an input to the Searcher's and prints its end
+// event if it has begun. A write error is stored in *err unless it is
+// already set.
+func (s *Searcher) endFile(st *fileState, err *error) {
+	s.selected += st.count
+	s.matches += st.matches
+	if !st.begun {
+		return
+	}
+	end := jsonEnd{Path: jsonText(st.name), Binary: st.binary}
+	end.Stats.MatchedLines = st.count
+	end.Stats.Matches = st.matches
+	if werr := s.printEvent("end", end); *err == nil {
+		*err = werr
+	}
+}
+
+// printJSONLine prints a match or, if context is set, a context event.
+func (s *Searcher) printJSONLine(st *fileState, lineNum int, offset int64, line []byte, context bool) error {
+	if err := s.beginFile(st); err != nil {
+		return err
+	}
+	ev := jsonLine{
+		Path:           jsonText(st.name),
+		LineNumber:     lineNum,
+		AbsoluteOffset: offset,
+		Line:           jsonText(line),
+		Submatches:     []jsonSubmatch{},
+	}
+	typ := "context"
+	if !context {
+		typ = "match"
+		for _, loc := range s.submatches(s.matcher, line) {
+			ev.Submatches = append(ev.Submatches, jsonSubmatch{jsonText(line[loc[0]:loc[1]]), loc[0], loc[1]})
+		}
+		st.matches += len(ev.Submatches)
+	}
+	return s.printEvent(typ, ev)
+}
+
+// printSummary prints the summary event of a SearchFiles call.
+func (s *Searcher) printSummary(sum Summary) error {
+	var ev jsonSummary
+	ev.Stats.Searched = sum.Searched
+	ev.Stats.Matched = sum.Matched
+	ev.Stats.Errored = sum.Errored
+	ev.Stats.MatchedLines = sum.Selected
+	ev.Stats.Matches = sum.Matches
+	return s.printEvent("summary", ev)
+}
@@ -0,0 +1,295 @@
+package search
+
+import (
+	"bytes"
+	"context"
+
+	grepio "github.com/codecrafters-io/grep-starter-go/internal/io"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// binarySniffLen is how much of a mapped file is checked by IsBinary,
+// matching the LineReader's first buffer.
+const binarySniffLen = 64 * 1024
+
+// chunkSize is the size of the pieces a mapped file is cut into when it is
+// searched on several workers. Files under two chunks are not split.
+const chunkSize = 8 << 20
+
+// indexFinder is implemented by matchers that can scan a buffer holding
+// many lines (see matcher.RegexMatcher.FindIndex).
+type indexFinder interface {
+	FindIndex(buf []byte, from int) []int
+}
+
+// submatchFinder is implemented by matchers that also find the bounds of
+// groups (see matcher.RegexMatcher.FindSubmatchIndex).
+type submatchFinder interface {
+	FindSubmatchIndex(buf []byte, from int) []int
+}
+
+// lineRecord is a line of a mapped file picked by scanChunk.
+type lineRecord struct {
+	start, end int // bounds of the line, without its newline
+	// rel is the number of newlines from the start of the chunk to the
+	// line, negative for leading context before the chunk.
+	rel     int
+	context bool
+}
+
+// lineCounter counts newlines from the start of a chunk to increasing
+// offsets.
+type lineCounter struct {
+	data   []byte
+	lo, at int
+	n      int // newlines in data[lo:at]
+}
+
+func (c *lineCounter) rel(off int) int {
+	switch {
+	case off < c.lo:
+		return -bytes.Count(c.data[off:c.lo], []byte{'\n'})
+	case off < c.at:
+		return c.n - bytes.Count(c.data[off:c.at], []byte{'\n'})
+	}
+	c.n += bytes.Count(c.data[c.at:off], []byte{'\n'})
+	c.at = off
+	return c.n
+}
+
+func lineEnd(data []byte, start int) int {
+	if i := bytes.IndexByte(data[start:], '\n'); i >= 0 {
+		return start + i
+	}
+	return len(data)
+}
+
+// searchMapped searches a whole file held in memory, on several workers when
+// it is large and s.workers allows (see searchChunked).
+func (s *Searcher) searchMapped(data []byte, name string) (matched bool, err error) {
+	st := &fileState{name: name, withName: s.opts.WithFilename, link: s.linkPath(name, 0)}
+	defer s.endFile(st, &err)
+	st.binary = s.opts.Binary != BinaryText && grepio.IsBinary(data[:min(len(data), binarySniffLen)])
+	if st.binary && s.opts.Binary == BinaryWithoutMatch {
+		return false, nil
+	}
+	if s.workers > 1 && len(data) >= 2*chunkSize && !st.binary && !s.opts.Quiet && !s.opts.FilesWithMatches {
+		return s.searchChunked(data, st)
+	}
+
+	_, scanErr := s.scanChunk(s.ctx, data, 0, len(data), s.opts.MaxCount, func(rec lineRecord) bool {
+		var done bool
+		done, err = s.printRecord(st, data, rec, 0)
+		return !done && err == nil
+	})
+	if err == nil {
+		err = scanErr
+	}
+	return st.count > 0, err
+}
+
+// printRecord prints a line picked by scanChunk. base is the number of
+// newlines before the chunk. It reports whether the file is done, as
+// selectLine does.
+func (s *Searcher) printRecord(st *fileState, data []byte, rec lineRecord, base int) (bool, error) {
+	lineNum := base + rec.rel + 1
+	line := data[rec.start:rec.end]
+	if rec.context {
+		return false, s.printContext(st, lineNum, int64(rec.start), line)
+	}
+	return s.selectLine(st, lineNum, int64(rec.start), line)
+}
+
+// scanChunk finds the matching lines that start in data[lo:hi], which holds
+// whole lines, and passes them with their context to emit, in order, until
+// emit returns false. Context may reach outside the chunk; trailing context
+// past hi stops at a matching line, which the next chunk reports. After limit
+// matches (0 for no limit) only their trailing context follows. Lines are
+// only counted for line numbers, context or a Format other than FormatText;
+// scanChunk then returns the number of newlines in data[lo:hi].
+func (s *Searcher) scanChunk(ctx context.Context, data []byte, lo, hi, limit int, emit func(lineRecord) bool) (int, error) {
+	finder, _ := s.matcher.(indexFinder)
+	counting := s.opts.LineNumber || s.hasContext() || s.opts.Format != FormatText
+	lines := lineCounter{data: data, lo: lo, at: lo}
+	record := func(start int, context bool) bool {
+		rec := lineRecord{start: start, end: lineEnd(data, start), context: context}
+		if counting {
+			rec.rel = lines.rel(start)
+		}
+		return emit(rec)
+	}
+	newlines := func() int {
+		if !counting {
+			return 0
+		}
+		return lines.rel(hi)
+	}
+
+	next := 0 // start of the first line not yet passed to emit
+	afterLeft := 0
+	matches := 0
+	for pos := lo; pos < hi && (limit == 0 || matches < limit); matches++ {
+		if matches%cancelCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		ms := s.nextMatch(data[:hi], pos, finder)
+		if ms < 0 {
+			break
+		}
+		for ; afterLeft > 0 && next < ms; afterLeft-- {
+			if !record(next, true) {
+				return newlines(), nil
+			}
+			next = lineEnd(data, next) + 1
+		}
+		first := ms
+		for i := 0; i < s.opts.BeforeContext && first > next; i++ {
+			first = bytes.LastIndexByte(data[:first-1], '\n') + 1
+		}
+		for ; first < ms; first = lineEnd(data, first) + 1 {
+			if !record(first, true) {
+				return newlines(), nil
+			}
+		}
+		if !record(ms, false) {
+			return newlines(), nil
+		}
+		next = lineEnd(data, ms) + 1
+		pos = next
+		afterLeft = s.opts.AfterContext
+	}
+
+	limited := limit > 0 && matches >= limit
+	for ; afterLeft > 0 && next < len(data); afterLeft-- {
+		end := lineEnd(data, next)
+		if next >= hi && !limited && s.matcher.Match(data[next:end], s.pattern) {
+			break
+		}
+		if !record(next, true) {
+			break
+		}
+		next = end + 1
+	}
+	return newlines(), nil
+}
+
+// nextMatch returns the start of the first line at or after pos in buf that
+// matches, or -1.
+func (s *Searcher) nextMatch(buf []byte, pos int, finder indexFinder) int {
+	if finder != nil {
+		loc := finder.FindIndex(buf, pos)
+		if loc == nil || loc[0] >= len(buf) {
+			return -1
+		}
+		return bytes.LastIndexByte(buf[:loc[0]], '\n') + 1
+	}
+	for pos < len(buf) {
+		end := lineEnd(buf, pos)
+		if s.matcher.Match(buf[pos:end], s.pattern) {
+			return pos
+		}
+		pos = end + 1
+	}
+	return -1
+}
+
+// chunkResult is what searching one chunk of a mapped file found.
+type chunkResult struct {
+	records  []lineRecord
+	newlines int
+}
+
+// chunkTask searches one chunk of a mapped file on a pkg.Engine and emits a
+// *chunkResult.
+type chunkTask struct {
+	searcher *Searcher
+	data     []byte
+	lo, hi   int
+}
+
+func (t *chunkTask) Execute(ctx context.Context) error {
+	res := &chunkResult{}
+	n, err := t.searcher.scanChunk(ctx, t.data, t.lo, t.hi, t.searcher.opts.MaxCount, func(rec lineRecord) bool {
+		res.records = append(res.records, rec)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	res.newlines = n
+	if !pkg.Emit(ctx, res) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// searchChunked cuts data into newline-aligned chunks, scans them on up to
+// s.workers at once and prints their lines in file order. Line numbers are
+// the chunk's own plus the newlines of the chunks before it. Context lines
+// that neighbouring chunks both picked are printed once, and MaxCount is
+// applied again over the whole file.
+func (s *Searcher) searchChunked(data []byte, st *fileState) (bool, error) {
+	engine := pkg.New()
+	engine.SetWorkers(s.workers)
+	for lo := 0; lo < len(data); {
+		hi := len(data)
+		if lo+chunkSize < len(data) {
+			hi = lineEnd(data, lo+chunkSize) + 1
+		}
+		engine.AddTask(&chunkTask{searcher: s, data: data, lo: lo, hi: min(hi, len(data))})
+		lo = hi
+	}
+	results := engine.Results()
+	done := make(chan error, 1)
+	go func() { done <- engine.Start(s.ctx) }()
+
+	var err error
+	base := 0
+	printedEnd := 0 // end of the last printed line, past its newline
+	limited, afterLeft := false, 0
+	order := reorder{fn: func(v any) {
+		res := v.(*chunkResult)
+		for _, rec := range res.records {
+			if err != nil || limited && afterLeft == 0 {
+				break
+			}
+			if rec.start < printedEnd {
+				continue
+			}
+			if limited {
+				// Trailing context of the last selected line, which
+				// may include lines the chunk took for matches.
+				if rec.start != printedEnd {
+					afterLeft = 0
+					break
+				}
+				rec.context = true
+				afterLeft--
+			}
+			if _, err = s.printRecord(st, data, rec, base); err != nil {
+				break
+			}
+			printedEnd = rec.end + 1
+			if !rec.context && s.limitReached(st) {
+				limited, afterLeft = true, s.opts.AfterContext
+			}
+		}
+		base += res.newlines
+		if err != nil || limited && afterLeft == 0 {
+			engine.Stop()
+		}
+	}}
+	for r := range results {
+		if !r.Done {
+			order.add(r.Index, r.Value)
+		}
+	}
+	<-done
+
+	if err == nil {
+		err = s.ctx.Err()
+	}
+	return st.count > 0, err
+}
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+// fileError is an error met while searching one file, reported once the
+// file's output is printed.
+type fileError struct {
+	name string
+	err  error
+}
+
+// fileResult is the buffered outcome of searching one file.
+type fileResult struct {
+	out     bytes.Buffer
+	matched bool
+	// selected and matches are the file's counts for Summary.
+	selected, matches int
+	results           []sarifResult
+	// errs holds archive member errors, then any error that ended the
+	// search of the file.
+	errs []fileError
+}
+
+// fileTask searches one file on a pkg.Engine with a Searcher of its own and
+// emits a *fileResult.
+type fileTask struct {
+	path string
+	// template is copied into the Searchers of the tasks. It is not
+	// written to once the engine starts.
+	template *Searcher
+	pool     *sync.Pool
+}
+
+func (t *fileTask) Execute(ctx context.Context) error {
+	res := &fileResult{}
+	s, _ := t.pool.Get().(*Searcher)
+	if s == nil {
+		clone := *t.template
+		s = &clone
+	}
+	s.out = &res.out
+	s.printed = false
+	s.results = nil
+	selected, matches := s.selected, s.matches
+	s.opts.ReportError = func(name string, err error) {
+		res.errs = append(res.errs, fileError{name, err})
+	}
+
+	matched, err := s.SearchFileContext(ctx, t.path)
+	res.selected, res.matches = s.selected-selected, s.matches-matches
+	res.results = s.results
+	// Once put back, s may be taken by another task.
+	t.pool.Put(s)
+	if ctx.Err() != nil {
+		// Stopped: whatever this file printed is incomplete.
+		return ctx.Err()
+	}
+	res.matched = matched
+	if err != nil {
+		res.errs = append(res.errs, fileError{displayName(t.path), err})
+	}
+	if !pkg.Emit(ctx, res) {
+		return ctx.Err()
+	}
+	return err
+}
+
+func displayName(path string) string {
+	if path == "-" {
+		return StdinName
+	}
+	return path
+}
+
+// Summary counts the files of a SearchFiles call. Archive members are not
+// counted separately.
+type Summary struct {
+	Searched int // files searched to the end, with or without errors
+	Matched  int // files with at least one selected line
+	Errored  int // files with an error, including archive member errors
+	Selected int // selected lines
+	Matches  int // matches in the selected lines, not counted for FormatText
+}
+
+// add counts one finished file.
+func (sum *Summary) add(matched, errored bool, selected, matches int) {
+	sum.Searched++
+	sum.Selected += selected
+	sum.Matches += matches
+	if matched {
+		sum.Matched++
+	}
+	if errored {
+		sum.Errored++
+	}
+}
+
+// SearchFiles searches paths on up to workers files at a time (see
+// pkg.Engine.SetWorkers). Each file's output is buffered and written whole,
+// in the order of paths, or as each file finishes when unordered is set.
+// Errors for a file are passed to Options.ReportError right after its output
+// and do not stop the search. With Options.Quiet the search stops at the
+// first file with a match. The returned error means the search stopped early
+// otherwise: ctx was cancelled or the Searcher's output could not be written.
+// Files that finished are still printed, in path order up to the first file
+// that was cut short. With FormatJSON a summary event follows the files;
+// with FormatSARIF the log of all their results is printed at the end.
+func (s *Searcher) SearchFiles(ctx context.Context, paths []string, workers int, unordered bool) (Summary, error) {
+	s.results = nil
+	sum, err := s.searchFiles(ctx, paths, workers, unordered)
+	if err != nil || s.opts.Quiet {
+		return sum, err
+	}
+	switch s.opts.Format {
+	case FormatJSON:
+		err = s.printSummary(sum)
+	case FormatSARIF:
+		err = s.printSARIF()
+	}
+	return sum, err
+}
+
+func (s *Searcher) searchFiles(ctx context.Context, paths []string, workers int, unordered bool) (Summary, error) {
+	engine := pkg.New()
+	engine.SetWorkers(workers)
+	if engine.Workers() == 1 || len(paths) == 1 {
+		// A single file may still be split (see searchChunked).
+		s.workers = engine.Workers()
+		defer func() { s.workers = 1 }()
+		return s.searchSequential(ctx, paths)
+	}
+
+	// The tasks copy a Searcher of their own from template rather than from
+	// s, whose output state changes as their results are printed.
+	template := &Searcher{
+		matcher: s.matcher,
+		pattern: s.pattern,
+		opts:    s.opts,
+		ctx:     context.Background(),
+		workers: 1,
+	}
+	var pool sync.Pool
+	for _, path := range paths {
+		engine.AddTask(&fileTask{path: path, template: template, pool: &pool})
+	}
+	results := engine.Results()
+	done := make(chan error, 1)
+	go func() { done <- engine.Start(ctx) }()
+
+	var sum Summary
+	var writeErr error
+	// sarif collects the files' SARIF results, which are given to s once
+	// the engine is done.
+	var sarif []sarifResult
+	emit := func(res *fileResult) {
+		sum.add(res.matched, len(res.errs) > 0, res.selected, res.matches)
+		if writeErr != nil {
+			return
+		}
+		if s.hasContext() && s.opts.Format == FormatText && res.out.Len() > 0 {
+			// The file's groups were separated from each other only.
+			if s.printed {
+				if _, err := io.WriteString(s.out, "--\n"); err != nil {
+					writeErr = err
+					engine.Stop()
+					return
+				}
+			}
+			s.printed = true
+		}
+		if _, err := io.Copy(s.out, &res.out); err != nil {
+			writeErr = err
+			engine.Stop()
+			return
+		}
+		sarif = append(sarif, res.results...)
+		for _, fe := range res.errs {
+			s.reportError(fe.name, fe.err)
+		}
+	}
+
+	order := reorder{fn: func(v any) { emit(v.(*fileResult)) }}
+	for r := range results {
+		res, ok := r.Value.(*fileResult)
+		if !ok {
+			continue
+		}
+		if res.matched && s.opts.Quiet {
+			sum.add(res.matched, len(res.errs) > 0, res.selected, res.matches)
+			engine.Stop()
+			continue
+		}
+		if unordered {
+			emit(res)
+			continue
+		}
+		order.add(r.Index, res)
+	}
+
+	<-done
+	s.results = sarif
+	switch {
+	case writeErr != nil:
+		return sum, writeErr
+	case ctx.Err() != nil:
+		return sum, ctx.Err()
+	}
+	return sum, nil
+}
+
+// reorder passes the values emitted by engine tasks to fn in task order.
+type reorder struct {
+	fn      func(v any)
+	pending map[int]any
+	next    int
+}
+
+func (o *reorder) add(index int, v any) {
+	if o.pending == nil {
+		o.pending = make(map[int]any)
+	}
+	o.pending[index] = v
+	for v, ok := o.pending[o.next]; ok; v, ok = o.pending[o.next] {
+		delete(o.pending, o.next)
+		o.next++
+		o.fn(v)
+	}
+}
+
+// searchSequential searches paths one at a time, streaming output directly.
+func (s *Searcher) searchSequential(ctx context.Context, paths []string) (Summary, error) {
+	var sum Summary
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+		errs, selected, matches := s.errors, s.selected, s.matches
+		matched, err := s.SearchFileContext(ctx, path)
+		if ctx.Err() != nil {
+			return sum, ctx.Err()
+		}
+		if err != nil {
+			s.reportError(displayName(path), err)
+		}
+		sum.add(matched, s.errors > errs, s.selected-selected, s.matches-matches)
+		if matched && s.opts.Quiet {
+			break
+		}
+	}
+	return sum, nil
+}
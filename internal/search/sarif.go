@@ -0,0 +1,156 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sarifVersion and sarifSchema identify the SARIF format printed.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// sarifLog is the subset of a SARIF log that FormatSARIF prints: one run
+// with a rule for each distinct rule ID and a result for each match.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	// ColumnKind says columns count code points rather than the default
+	// UTF-16 code units.
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region sarifRegion `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// sarifRegion locates a match on its line. Columns are 1-based and the end
+// column is that of the first character after the match.
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	StartColumn int           `json:"startColumn"`
+	EndColumn   int           `json:"endColumn"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+// rules returns the rules to report and the index in the log's rule list of
+// each.
+func (s *Searcher) rules() ([]Rule, []int, []sarifRule) {
+	rules := s.opts.Rules
+	if len(rules) == 0 {
+		rules = []Rule{{ID: s.pattern, Pattern: s.pattern, Matcher: s.matcher}}
+	}
+	index := make([]int, len(rules))
+	var list []sarifRule
+	seen := make(map[string]int)
+	for i, r := range rules {
+		j, ok := seen[r.ID]
+		if !ok {
+			j = len(list)
+			seen[r.ID] = j
+			list = append(list, sarifRule{r.ID, sarifMessage{r.Pattern}})
+		}
+		index[i] = j
+	}
+	return rules, index, list
+}
+
+// addResults records a result for each match of each rule in a selected
+// line.
+func (s *Searcher) addResults(st *fileState, lineNum int, offset int64, line []byte) {
+	rules, index, _ := s.rules()
+	uri := sarifURI(st.name)
+	for i, r := range rules {
+		for _, loc := range s.submatches(r.Matcher, line) {
+			res := sarifResult{
+				RuleID:    r.ID,
+				RuleIndex: index[i],
+				Level:     "warning",
+				Message:   sarifMessage{fmt.Sprintf("%s matched %q", r.ID, line[loc[0]:loc[1]])},
+			}
+			var l sarifLocation
+			l.PhysicalLocation.ArtifactLocation.URI = uri
+			l.PhysicalLocation.Region = sarifRegion{
+				StartLine:   lineNum,
+				StartColumn: utf8.RuneCount(line[:loc[0]]) + 1,
+				EndColumn:   utf8.RuneCount(line[:loc[1]]) + 1,
+			}
+			if !st.binary {
+				l.PhysicalLocation.Region.Snippet = &sarifMessage{string(line)}
+			}
+			res.Locations = []sarifLocation{l}
+			s.results = append(s.results, res)
+			st.matches++
+		}
+	}
+}
+
+// sarifURI returns the URI of a file name: a relative reference for a
+// relative path, a file URI for an absolute one. Archive members keep the
+// archive!member form.
+func sarifURI(name string) string {
+	path := filepath.ToSlash(name)
+	if filepath.IsAbs(name) {
+		if !strings.HasPrefix(path, "/") {
+			// A Windows drive letter.
+			path = "/" + path
+		}
+		return (&url.URL{Scheme: "file", Path: path}).String()
+	}
+	return (&url.URL{Path: path}).String()
+}
+
+// printSARIF prints the log of the results of a SearchFiles call.
+func (s *Searcher) printSARIF() error {
+	_, _, rules := s.rules()
+	var run sarifRun
+	run.Tool.Driver.Name = "mygrep"
+	run.Tool.Driver.Rules = rules
+	run.ColumnKind = "unicodeCodePoints"
+	run.Results = s.results
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	enc := json.NewEncoder(s.out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{sarifVersion, sarifSchema, []sarifRun{run}})
+}
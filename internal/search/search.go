@@ -0,0 +1,577 @@
+// internal/search/search.go
+package search
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	grepio "github.com/codecrafters-io/grep-starter-go/internal/io"
+	"github.com/codecrafters-io/grep-starter-go/internal/lang"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+)
+
+// StdinName is how standard input is named in output.
+const StdinName = "(standard input)"
+
+// MmapThreshold is the size from which regular files are memory-mapped
+// rather than read.
+const MmapThreshold = 1 << 20
+
+// cancelCheckLines is how many lines are read between checks for
+// cancellation.
+const cancelCheckLines = 4096
+
+// DefaultMaxMemberSize is the archive member size cap used when
+// Options.MaxMemberSize is zero.
+const DefaultMaxMemberSize = 256 << 20
+
+// BinaryMode says how files detected as binary are handled.
+type BinaryMode int
+
+const (
+	// BinaryReport prints "Binary file X matches" instead of the matching lines.
+	BinaryReport BinaryMode = iota
+	// BinaryText searches binary files as if they were text (-a).
+	BinaryText
+	// BinaryWithoutMatch assumes binary files do not match (-I).
+	BinaryWithoutMatch
+)
+
+// ParseBinaryMode parses a --binary-files value.
+func ParseBinaryMode(s string) (BinaryMode, error) {
+	switch s {
+	case "binary":
+		return BinaryReport, nil
+	case "text":
+		return BinaryText, nil
+	case "without-match":
+		return BinaryWithoutMatch, nil
+	}
+	return 0, fmt.Errorf("invalid --binary-files type %q", s)
+}
+
+// Format selects how selected lines are printed.
+type Format int
+
+const (
+	// FormatText prints each line with the prefixes the options ask for.
+	FormatText Format = iota
+	// FormatJSON prints JSON Lines events (see jsonEvent).
+	FormatJSON
+	// FormatSARIF prints a SARIF log with a result for each match of each
+	// of Options.Rules once the search is done (see SearchFiles). Context
+	// lines are not reported.
+	FormatSARIF
+	// FormatTemplate prints lines with Options.Template.
+	FormatTemplate
+)
+
+// Options control how inputs are read and how matches are reported.
+type Options struct {
+	// Decompress searches the decompressed content of gzip, bzip2, zlib and
+	// compress (.Z) inputs (-z, --search-zip).
+	Decompress bool
+	// ArchiveDepth is how many levels of nested tar and zip archives are
+	// opened when Decompress is set (--zmax). Members are reported as
+	// archive!path. Without Decompress, archives are searched as they are.
+	ArchiveDepth int
+	// MaxMemberSize caps the size of an archive member that is searched,
+	// and of a zip that is not a regular file and so is read into memory.
+	MaxMemberSize int64
+	// Mmap lets large regular files be memory-mapped and scanned as a
+	// whole, finding line boundaries only around matches. Files that need
+	// decompression or transcoding are always read.
+	Mmap bool
+	// Encoding is the text encoding of the inputs (--encoding). They are
+	// transcoded to UTF-8 before matching.
+	Encoding grepio.Encoding
+	// Binary selects how binary files are handled. Files are classified
+	// from their first buffer (see grepio.IsBinary).
+	Binary BinaryMode
+	// WithFilename prefixes each printed line with the name of its input.
+	WithFilename bool
+	// LineNumber prefixes each printed line with its 1-based line number.
+	LineNumber bool
+	// ByteOffset prefixes each printed line with the offset of its first
+	// byte in the input.
+	ByteOffset bool
+	// BeforeContext and AfterContext are how many lines around each
+	// selected line are printed as context (-B, -A). Context lines are
+	// marked with '-' instead of ':', and "--" separates groups of lines
+	// that are not adjacent.
+	BeforeContext int
+	AfterContext  int
+	// MaxCount stops reading an input after this many selected lines (-m),
+	// once their trailing context is printed. Zero means no limit.
+	MaxCount int
+	// FilesWithMatches prints only the name of each input with a match and
+	// stops reading it at the first one (-l).
+	FilesWithMatches bool
+	// Quiet prints nothing and stops reading an input at its first match
+	// (-q).
+	Quiet bool
+	// Format is how selected and context lines are printed. Prefixes and
+	// separators only apply to FormatText.
+	Format Format
+	// Hyperlink, if set, makes the file name of each line printed with
+	// FormatText an OSC 8 terminal hyperlink, or the line number when no
+	// name is printed; with FilesWithMatches, the name printed.
+	Hyperlink *Hyperlink
+	// Template is the layout of FormatTemplate, parsed for the matcher's
+	// groups.
+	Template *Template
+	// Rules are the patterns that FormatSARIF reports matches of. Each has
+	// a matcher of its own, so a match is reported under every rule that
+	// finds it. Without rules, the Searcher's pattern is the only one.
+	Rules []Rule
+	// Regions, if set, limits matches to regions of each input, such as
+	// its comments (--lang, --only). It is given the input's name and
+	// content, which is then read whole, and returns the regions sorted
+	// and not overlapping (see lang.Regions). A line is selected when a
+	// match lies within one region.
+	Regions func(name string, src []byte) ([]lang.Span, error)
+	// ReportError is called for errors that do not stop the search, such as
+	// an unreadable archive member.
+	ReportError func(name string, err error)
+}
+
+// Rule is a pattern reported by FormatSARIF.
+type Rule struct {
+	ID      string
+	Pattern string
+	Matcher matcher.Matcher
+}
+
+// Searcher runs a matcher over inputs and prints the selected lines.
+type Searcher struct {
+	matcher matcher.Matcher
+	pattern string
+	opts    Options
+	out     io.Writer
+	lines   *grepio.LineReader
+	ctx     context.Context
+	errors  int // calls to reportError
+	// workers is how many chunks of one mapped file may be searched at
+	// once (see searchChunked).
+	workers int
+	// printed is set once a line has been printed with context enabled, so
+	// the next group is preceded by a separator.
+	printed bool
+	// regions of the input being searched, from Options.Regions, and the
+	// offset of the current line in the text they refer to, which differs
+	// from its offset in the input once transcoded.
+	regions    []lang.Span
+	lineOffset int
+	// selected and matches total the fileState counts of the inputs
+	// searched, for Summary.
+	selected, matches int
+	// results are the FormatSARIF results of the inputs searched.
+	results []sarifResult
+}
+
+// fileState tracks the selected lines of one input.
+type fileState struct {
+	name     string
+	withName bool
+	binary   bool
+	count    int
+	matches  int    // matches printed with formats other than FormatText
+	lastLine int    // number of the last line printed, 0 for none
+	begun    bool   // a begin event was printed (FormatJSON)
+	link     string // the {path} of Options.Hyperlink, "" for no links
+}
+
+// contextLine is a line kept for leading context.
+type contextLine struct {
+	num    int
+	offset int64
+	text   []byte
+}
+
+// contextRing keeps the last few lines read, reusing their buffers.
+type contextRing struct {
+	lines    []contextLine
+	start, n int
+}
+
+func (r *contextRing) push(num int, offset int64, text []byte) {
+	if len(r.lines) == 0 {
+		return
+	}
+	i := (r.start + r.n) % len(r.lines)
+	if r.n == len(r.lines) {
+		r.start = (r.start + 1) % len(r.lines)
+	} else {
+		r.n++
+	}
+	l := &r.lines[i]
+	l.num, l.offset = num, offset
+	l.text = append(l.text[:0], text...)
+}
+
+// flush passes the kept lines to fn, oldest first, and empties the ring.
+func (r *contextRing) flush(fn func(l *contextLine) error) error {
+	defer func() { r.start, r.n = 0, 0 }()
+	for i := 0; i < r.n; i++ {
+		if err := fn(&r.lines[(r.start+i)%len(r.lines)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// New returns a Searcher that writes selected lines to out.
+func New(m matcher.Matcher, pattern string, out io.Writer, opts Options) *Searcher {
+	if opts.MaxMemberSize == 0 {
+		opts.MaxMemberSize = DefaultMaxMemberSize
+	}
+	return &Searcher{
+		matcher: m,
+		pattern: pattern,
+		opts:    opts,
+		out:     out,
+		ctx:     context.Background(),
+		workers: 1,
+	}
+}
+
+// SearchFile searches the named file, "-" meaning standard input, and
+// reports whether any line matched.
+func (s *Searcher) SearchFile(path string) (bool, error) {
+	return s.SearchFileContext(context.Background(), path)
+}
+
+// SearchFileContext is SearchFile, giving up with ctx's error once ctx is
+// cancelled. Lines already printed are kept.
+func (s *Searcher) SearchFileContext(ctx context.Context, path string) (bool, error) {
+	s.ctx = ctx
+	defer func() { s.ctx = context.Background() }()
+
+	if path == "-" {
+		return s.Search(os.Stdin, StdinName)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if s.opts.Mmap && !s.opts.Decompress && s.opts.Regions == nil && (s.opts.Encoding == grepio.EncodingAuto || s.opts.Encoding == grepio.UTF8) {
+		if data, unmap, err := grepio.Mmap(f, MmapThreshold); err == nil {
+			defer unmap()
+			if !grepio.HasBOM(data) {
+				return s.searchMapped(data, path)
+			}
+		}
+	}
+	return s.Search(f, path)
+}
+
+// Search searches r, reporting its lines under name. Lines printed before a
+// read error (such as a corrupt archive) are kept.
+func (s *Searcher) Search(r io.Reader, name string) (bool, error) {
+	return s.search(r, name, 0)
+}
+
+func (s *Searcher) search(r io.Reader, name string, depth int) (matched bool, err error) {
+	if s.opts.Decompress {
+		dr, kind, err := grepio.Decompress(r)
+		if err != nil {
+			return false, err
+		}
+		br, ok := dr.(*bufio.Reader)
+		if !ok {
+			br = bufio.NewReader(dr)
+		}
+		head, _ := br.Peek(512)
+		if archive := grepio.DetectArchive(head); archive != grepio.NotArchive && depth < s.opts.ArchiveDepth {
+			var src io.Reader = br
+			if f, ok := r.(*os.File); ok && archive == grepio.Zip && kind == grepio.Uncompressed && isRegular(f) {
+				// Let zip read the central directory straight from disk.
+				src = f
+			}
+			return s.searchArchive(src, archive, name, depth)
+		}
+		r = br
+	}
+
+	r, err = grepio.Transcode(r, s.opts.Encoding)
+	if err != nil {
+		return false, err
+	}
+	if s.opts.Regions != nil {
+		src, err := io.ReadAll(r)
+		if err != nil {
+			return false, err
+		}
+		if s.regions, err = s.opts.Regions(name, src); err != nil {
+			return false, err
+		}
+		defer func() { s.regions = nil }()
+		r = grepio.Reread(r, src)
+	}
+	if s.lines == nil {
+		s.lines = grepio.NewLineReader(r)
+	} else {
+		s.lines.Reset(r)
+	}
+
+	st := &fileState{name: name, withName: s.opts.WithFilename || depth > 0, link: s.linkPath(name, depth)}
+	defer s.endFile(st, &err)
+	st.binary = s.opts.Binary != BinaryText && grepio.IsBinary(s.lines.Peek())
+	if st.binary && s.opts.Binary == BinaryWithoutMatch {
+		return false, s.lines.Err()
+	}
+
+	before := contextRing{lines: make([]contextLine, s.opts.BeforeContext)}
+	printBefore := func(l *contextLine) error {
+		return s.printContext(st, l.num, l.offset, l.text)
+	}
+	afterLeft := 0
+	// limited is set once MaxCount lines are selected; only their
+	// trailing context is still printed.
+	limited := false
+	lineNum := 0
+	for s.lines.Next() {
+		lineNum++
+		if lineNum%cancelCheckLines == 0 {
+			if err := s.ctx.Err(); err != nil {
+				return st.count > 0, err
+			}
+		}
+		line := s.lines.Line()
+		s.lineOffset = int(s.lines.TextOffset())
+		switch {
+		case !limited && s.match(line):
+			if err := before.flush(printBefore); err != nil {
+				return true, err
+			}
+			if done, err := s.selectLine(st, lineNum, s.lines.Offset(), line); done || err != nil {
+				return true, err
+			}
+			afterLeft = s.opts.AfterContext
+			limited = s.limitReached(st)
+		case afterLeft > 0:
+			if err := s.printContext(st, lineNum, s.lines.Offset(), line); err != nil {
+				return true, err
+			}
+			afterLeft--
+		default:
+			before.push(lineNum, s.lines.Offset(), line)
+		}
+		if limited && afterLeft == 0 {
+			return true, nil
+		}
+	}
+	return st.count > 0, s.lines.Err()
+}
+
+// match reports whether line has a match, within one of the input's regions
+// if Options.Regions is set.
+func (s *Searcher) match(line []byte) bool {
+	if s.opts.Regions == nil {
+		return s.matcher.Match(line, s.pattern)
+	}
+	start := s.lineOffset
+	i := sort.Search(len(s.regions), func(i int) bool { return s.regions[i].End > start })
+	if i == len(s.regions) || s.regions[i].Start >= start+len(line) {
+		// No region on this line.
+		return false
+	}
+	finder, ok := s.matcher.(indexFinder)
+	if !ok {
+		return s.matcher.Match(line, s.pattern) && lang.Contains(s.regions, start, start+len(line))
+	}
+	for from := 0; from <= len(line); {
+		loc := finder.FindIndex(line, from)
+		if loc == nil {
+			return false
+		}
+		if lang.Contains(s.regions, start+loc[0], start+loc[1]) {
+			return true
+		}
+		if loc[0] == len(line) {
+			return false
+		}
+		_, size := utf8.DecodeRune(line[loc[0]:])
+		from = loc[0] + size
+	}
+	return false
+}
+
+// submatches returns the bounds of the matches of m in line that lie within
+// the input's regions if Options.Regions is set, line then being the current
+// line of the input. Those of groups follow if m finds them (see
+// submatchFinder).
+func (s *Searcher) submatches(m matcher.Matcher, line []byte) [][]int {
+	find := func(line []byte, from int) []int { return nil }
+	if f, ok := m.(submatchFinder); ok {
+		find = f.FindSubmatchIndex
+	} else if f, ok := m.(indexFinder); ok {
+		find = f.FindIndex
+	}
+	var locs [][]int
+	for from := 0; from <= len(line); {
+		loc := find(line, from)
+		if loc == nil {
+			break
+		}
+		if s.opts.Regions == nil || lang.Contains(s.regions, s.lineOffset+loc[0], s.lineOffset+loc[1]) {
+			locs = append(locs, loc)
+		}
+		switch {
+		case loc[1] > loc[0]:
+			from = loc[1]
+		case loc[0] == len(line):
+			from = len(line) + 1
+		default:
+			_, size := utf8.DecodeRune(line[loc[0]:])
+			from = loc[0] + size
+		}
+	}
+	return locs
+}
+
+// hasContext reports whether context lines, and so separators, are printed.
+func (s *Searcher) hasContext() bool {
+	if s.opts.Quiet || s.opts.FilesWithMatches {
+		return false
+	}
+	return s.opts.BeforeContext > 0 || s.opts.AfterContext > 0
+}
+
+// limitReached reports whether MaxCount lines of the input were selected.
+func (s *Searcher) limitReached(st *fileState) bool {
+	return s.opts.MaxCount > 0 && st.count >= s.opts.MaxCount
+}
+
+// selectLine reports a matching line as the options ask and says whether the
+// rest of the input can be skipped because the input's result is known.
+func (s *Searcher) selectLine(st *fileState, lineNum int, offset int64, line []byte) (bool, error) {
+	st.count++
+	switch {
+	case s.opts.Quiet:
+		return true, nil
+	case s.opts.FilesWithMatches:
+		url := s.lineURL(st, lineNum, offset, line, false)
+		_, err := s.out.Write(append(appendLink(nil, url, st.name), '\n'))
+		return true, err
+	case st.binary && s.opts.Format == FormatJSON:
+		// The end event tells the file is binary.
+		return true, s.beginFile(st)
+	case s.opts.Format == FormatSARIF:
+		s.addResults(st, lineNum, offset, line)
+		return false, nil
+	case st.binary:
+		_, err := fmt.Fprintf(s.out, "Binary file %s matches\n", st.name)
+		return true, err
+	}
+	return false, s.printGrouped(st, lineNum, offset, line, ':')
+}
+
+// printContext prints a context line. Context is not printed for inputs
+// whose result is reported without their lines.
+func (s *Searcher) printContext(st *fileState, lineNum int, offset int64, line []byte) error {
+	if s.opts.Quiet || s.opts.FilesWithMatches || st.binary || s.opts.Format == FormatSARIF {
+		return nil
+	}
+	return s.printGrouped(st, lineNum, offset, line, '-')
+}
+
+// printGrouped prints a line, preceded by a "--" separator when context is
+// enabled and it does not follow the previously printed line.
+func (s *Searcher) printGrouped(st *fileState, lineNum int, offset int64, line []byte, sep byte) error {
+	switch s.opts.Format {
+	case FormatJSON:
+		st.lastLine = lineNum
+		return s.printJSONLine(st, lineNum, offset, line, sep == '-')
+	case FormatTemplate:
+		st.lastLine = lineNum
+		return s.printTemplate(st, lineNum, offset, line, sep == '-')
+	}
+	if s.hasContext() {
+		if s.printed && (st.lastLine == 0 || lineNum != st.lastLine+1) {
+			if _, err := io.WriteString(s.out, "--\n"); err != nil {
+				return err
+			}
+		}
+		s.printed = true
+	}
+	st.lastLine = lineNum
+	return s.printLine(st, lineNum, offset, line, sep)
+}
+
+func isRegular(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// searchArchive searches each member of an archive as a file of its own.
+// Member errors are reported and skipped; the returned error means the
+// archive itself could not be read.
+func (s *Searcher) searchArchive(r io.Reader, kind grepio.Archive, name string, depth int) (bool, error) {
+	matched := false
+	err := grepio.WalkArchive(r, kind, s.opts.MaxMemberSize, func(path string, mr io.Reader, err error) {
+		member := name + "!" + path
+		if s.ctx.Err() != nil || matched && s.opts.Quiet {
+			// Skip the remaining members.
+			return
+		}
+		if err == nil {
+			var ok bool
+			ok, err = s.search(mr, member, depth+1)
+			matched = matched || ok
+		}
+		if err != nil && s.ctx.Err() == nil {
+			s.reportError(member, err)
+		}
+	})
+	if err == nil {
+		err = s.ctx.Err()
+	}
+	return matched, err
+}
+
+func (s *Searcher) reportError(name string, err error) {
+	s.errors++
+	if s.opts.ReportError != nil {
+		s.opts.ReportError(name, err)
+	}
+}
+
+// printLine prints line with the enabled prefixes, each followed by sep.
+func (s *Searcher) printLine(st *fileState, lineNum int, offset int64, line []byte, sep byte) error {
+	var prefix []byte
+	url := s.lineURL(st, lineNum, offset, line, sep == '-')
+	if st.withName {
+		prefix = appendLink(prefix, url, st.name)
+		prefix = append(prefix, sep)
+		url = ""
+	}
+	if s.opts.LineNumber {
+		if url == "" {
+			prefix = strconv.AppendInt(prefix, int64(lineNum), 10)
+		} else {
+			prefix = appendLink(prefix, url, strconv.Itoa(lineNum))
+		}
+		prefix = append(prefix, sep)
+	}
+	if s.opts.ByteOffset {
+		prefix = strconv.AppendInt(prefix, offset, 10)
+		prefix = append(prefix, sep)
+	}
+	if _, err := s.out.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := s.out.Write(line); err != nil {
+		return err
+	}
+	_, err := s.out.Write([]byte{'\n'})
+	return err
+}
@@ -0,0 +1,274 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template is a parsed FormatTemplate layout. Text is copied as is, except
+// for the escapes \t, \n, \\, \{ and \}, and these fields are replaced:
+//
+//	{path}     name of the input
+//	{line}     line number
+//	{col}      1-based byte column of the match
+//	{offset}   byte offset of the match in the input, or of the line for
+//	           context lines
+//	{text}     the whole line, without its newline
+//	{match}    text of the match
+//	{N}        text of group N, {0} being the whole match
+//	{<NAME>}   text of the group named NAME
+//	{count}    selected lines of the input so far, including this one
+//	{matches}  matches in the input so far, including this one
+//
+// A template using col, offset, match, groups or matches is printed once
+// for each match in a selected line; others once per line. Context lines
+// are printed once, with the fields of the match empty. Within
+// {if context}...{end} or {if match}...{end}, text is printed only for
+// context or selected lines; {else} may divide the two branches. Each
+// printing ends with a newline.
+type Template struct {
+	nodes    []tmplNode
+	perMatch bool
+}
+
+// tmplNode is literal text, a field, or a conditional with its branches.
+type tmplNode struct {
+	text  string
+	field string // a field name, "" for text and conditionals
+	group int    // for field "group"
+	cond  string // "context" or "match" for conditionals
+	then  []tmplNode
+	els   []tmplNode
+}
+
+// tmplFields are the field names of a template, and whether each is one of
+// a match.
+var tmplFields = map[string]bool{
+	"path":    false,
+	"line":    false,
+	"col":     true,
+	"offset":  true,
+	"text":    false,
+	"match":   true,
+	"count":   false,
+	"matches": true,
+}
+
+// ParseTemplate parses a template for a pattern whose groups have names
+// (see matcher.RegexMatcher.SubexpNames).
+func ParseTemplate(src string, names []string) (*Template, error) {
+	p := &tmplParser{src: src, names: names}
+	nodes, end, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	if end != "" {
+		return nil, fmt.Errorf("template: {%s} without {if}", end)
+	}
+	return &Template{nodes: nodes, perMatch: p.perMatch}, nil
+}
+
+type tmplParser struct {
+	src      string
+	pos      int
+	names    []string
+	perMatch bool
+}
+
+// parse parses nodes up to the end of the template or to an {else} or
+// {end}, which it returns.
+func (p *tmplParser) parse() ([]tmplNode, string, error) {
+	var nodes []tmplNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, tmplNode{text: text.String()})
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '\\':
+			if p.pos+1 == len(p.src) {
+				return nil, "", fmt.Errorf("trailing \\")
+			}
+			switch e := p.src[p.pos+1]; e {
+			case 't':
+				text.WriteByte('\t')
+			case 'n':
+				text.WriteByte('\n')
+			case '\\', '{', '}':
+				text.WriteByte(e)
+			default:
+				return nil, "", fmt.Errorf("unknown escape \\%c", e)
+			}
+			p.pos += 2
+		case '}':
+			return nil, "", fmt.Errorf("unexpected } at offset %d; write \\}", p.pos)
+		case '{':
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unclosed { at offset %d", p.pos)
+			}
+			name := p.src[p.pos+1 : p.pos+end]
+			p.pos += end + 1
+			flush()
+			switch {
+			case name == "else" || name == "end":
+				return nodes, name, nil
+			case strings.HasPrefix(name, "if "):
+				n, err := p.parseIf(strings.TrimSpace(name[3:]))
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			default:
+				n, err := p.field(name)
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			}
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, "", nil
+}
+
+func (p *tmplParser) parseIf(cond string) (tmplNode, error) {
+	if cond != "context" && cond != "match" {
+		return tmplNode{}, fmt.Errorf("unknown condition %q: want context or match", cond)
+	}
+	n := tmplNode{cond: cond}
+	var end string
+	var err error
+	if n.then, end, err = p.parse(); err != nil {
+		return n, err
+	}
+	if end == "else" {
+		if n.els, end, err = p.parse(); err != nil {
+			return n, err
+		}
+	}
+	if end != "end" {
+		return n, fmt.Errorf("{if %s} without {end}", cond)
+	}
+	return n, nil
+}
+
+func (p *tmplParser) field(name string) (tmplNode, error) {
+	if perMatch, ok := tmplFields[name]; ok {
+		p.perMatch = p.perMatch || perMatch
+		return tmplNode{field: name}, nil
+	}
+	group := -1
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 {
+		if n >= len(p.names) {
+			return tmplNode{}, fmt.Errorf("no group %d in the pattern", n)
+		}
+		group = n
+	} else if len(name) > 2 && name[0] == '<' && name[len(name)-1] == '>' {
+		for i, gn := range p.names {
+			if gn == name[1:len(name)-1] {
+				group = i
+				break
+			}
+		}
+		if group < 0 {
+			return tmplNode{}, fmt.Errorf("no group named %s in the pattern", name[1:len(name)-1])
+		}
+	} else {
+		return tmplNode{}, fmt.Errorf("unknown field {%s}", name)
+	}
+	p.perMatch = true
+	return tmplNode{field: "group", group: group}, nil
+}
+
+// tmplData is what a printing of a template refers to. loc is nil for
+// context lines and lines printed without a match.
+type tmplData struct {
+	st      *fileState
+	lineNum int
+	offset  int64
+	line    []byte
+	loc     []int
+	context bool
+}
+
+func (t *Template) execute(b []byte, nodes []tmplNode, d *tmplData) []byte {
+	for _, n := range nodes {
+		switch {
+		case n.cond != "":
+			if (n.cond == "context") == d.context {
+				b = t.execute(b, n.then, d)
+			} else {
+				b = t.execute(b, n.els, d)
+			}
+		case n.field == "":
+			b = append(b, n.text...)
+		default:
+			b = d.appendField(b, n)
+		}
+	}
+	return b
+}
+
+func (d *tmplData) appendField(b []byte, n tmplNode) []byte {
+	switch n.field {
+	case "path":
+		return append(b, d.st.name...)
+	case "line":
+		return strconv.AppendInt(b, int64(d.lineNum), 10)
+	case "text":
+		return append(b, d.line...)
+	case "count":
+		return strconv.AppendInt(b, int64(d.st.count), 10)
+	case "matches":
+		return strconv.AppendInt(b, int64(d.st.matches), 10)
+	case "offset":
+		if d.loc == nil {
+			return strconv.AppendInt(b, d.offset, 10)
+		}
+		return strconv.AppendInt(b, d.offset+int64(d.loc[0]), 10)
+	}
+	if d.loc == nil {
+		return b
+	}
+	switch n.field {
+	case "col":
+		return strconv.AppendInt(b, int64(d.loc[0]+1), 10)
+	case "match":
+		return append(b, d.line[d.loc[0]:d.loc[1]]...)
+	}
+	if i := 2 * n.group; i+1 < len(d.loc) && d.loc[i] >= 0 {
+		return append(b, d.line[d.loc[i]:d.loc[i+1]]...)
+	}
+	return b
+}
+
+// printTemplate prints a selected line, or a context line if context is
+// set, with Options.Template.
+func (s *Searcher) printTemplate(st *fileState, lineNum int, offset int64, line []byte, context bool) error {
+	t := s.opts.Template
+	d := &tmplData{st: st, lineNum: lineNum, offset: offset, line: line, context: context}
+	var locs [][]int
+	if !context && t.perMatch {
+		locs = s.submatches(s.matcher, line)
+	}
+	var b []byte
+	if len(locs) == 0 {
+		b = append(t.execute(b, t.nodes, d), '\n')
+	}
+	for _, loc := range locs {
+		st.matches++
+		d.loc = loc
+		b = append(t.execute(b, t.nodes, d), '\n')
+	}
+	_, err := s.out.Write(b)
+	return err
+}
@@ -0,0 +1,475 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The assembly format has one instruction per line, in the form
+//
+//	[label:] mnemonic [operand {, operand}] [; comment]
+//
+// Mnemonics are the names in opTable. Jump targets are labels, runes are Go
+// quoted characters ('a', '\n'), and a class is written as its items in
+// brackets, negated by a leading ^:
+//
+//	class [^'a'-'z' '_' \d \W:ascii \p{Greek} \P{L}]
+//
+// Assertions take a kind (begin, end, boundary, noboundary, boundary-ascii,
+// noboundary-ascii) and look takes pos or neg before its end label.
+
+// Disassemble renders code in the assembly format, naming jump targets L1,
+// L2, ... in program order. comment, if not nil, supplies a trailing comment
+// for the instruction at each offset. Assemble turns the listing back into
+// the same bytes.
+func Disassemble(code []byte, comment func(pc int) string) (string, error) {
+	var starts []int
+	targets := make(map[int]int) // target -> offset of a jump to it
+	for pc := 0; pc < len(code); {
+		size, err := instrLen(code, pc)
+		if err != nil {
+			return "", fmt.Errorf("offset %d: %w", pc, err)
+		}
+		for _, t := range jumpTargets(code, pc) {
+			targets[t] = pc
+		}
+		starts = append(starts, pc)
+		pc += size
+	}
+
+	pcs := make([]int, 0, len(targets))
+	for t, from := range targets {
+		i := sort.SearchInts(starts, t)
+		if t != len(code) && (i == len(starts) || starts[i] != t) {
+			return "", fmt.Errorf("offset %d: jump target %d is not an instruction", from, t)
+		}
+		pcs = append(pcs, t)
+	}
+	sort.Ints(pcs)
+	labels := make(map[int]string, len(pcs))
+	for i, t := range pcs {
+		labels[t] = "L" + strconv.Itoa(i+1)
+	}
+
+	var b strings.Builder
+	for _, pc := range starts {
+		text := formatInstr(code, pc, labels)
+		if comment != nil {
+			if c := comment(pc); c != "" {
+				text = fmt.Sprintf("%-32s ; %s", text, c)
+			}
+		}
+		label := ""
+		if name, ok := labels[pc]; ok {
+			label = name + ":"
+		}
+		fmt.Fprintf(&b, "%-8s%s\n", label, text)
+	}
+	if name, ok := labels[len(code)]; ok {
+		fmt.Fprintf(&b, "%s:\n", name)
+	}
+	return b.String(), nil
+}
+
+// jumpTargets returns the offsets an instruction can continue at other than
+// the next instruction.
+func jumpTargets(code []byte, pc int) []int {
+	switch code[pc] {
+	case OpSplit:
+		return []int{readU32(code, pc+1), readU32(code, pc+5)}
+	case OpJmp:
+		return []int{readU32(code, pc+1)}
+	case OpLook:
+		return []int{readU32(code, pc+2)}
+	}
+	return nil
+}
+
+// FormatInstr renders the instruction at pc in the assembly format, with jump
+// targets as offsets rather than labels. The program must have passed Verify.
+func FormatInstr(code []byte, pc int) string {
+	return formatInstr(code, pc, nil)
+}
+
+func formatInstr(code []byte, pc int, labels map[int]string) string {
+	op := code[pc]
+	name := opTable[op].name
+	target := func(off int) string {
+		if label, ok := labels[readU32(code, off)]; ok {
+			return label
+		}
+		return strconv.Itoa(readU32(code, off))
+	}
+	switch op {
+	case OpPush:
+		return fmt.Sprintf("%s %d", name, code[pc+1])
+	case OpChar:
+		return fmt.Sprintf("%s %s", name, strconv.QuoteRune(rune(readU32(code, pc+1))))
+	case OpClass:
+		set, _, _ := DecodeCharSet(code[pc+1:])
+		return fmt.Sprintf("%s %s", name, set)
+	case OpSplit:
+		return fmt.Sprintf("%s %s, %s", name, target(pc+1), target(pc+5))
+	case OpJmp:
+		return fmt.Sprintf("%s %s", name, target(pc+1))
+	case OpSave, OpBackref, OpProgress:
+		return fmt.Sprintf("%s %d", name, readU16(code, pc+1))
+	case OpAssert:
+		kind, ok := assertNames[code[pc+1]]
+		if !ok {
+			kind = strconv.Itoa(int(code[pc+1]))
+		}
+		return fmt.Sprintf("%s %s", name, kind)
+	case OpLook:
+		sense := "pos"
+		if code[pc+1] != 0 {
+			sense = "neg"
+		}
+		return fmt.Sprintf("%s %s, %s", name, sense, target(pc+2))
+	}
+	return name
+}
+
+// String renders the set in the assembly format.
+func (s *CharSet) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	if s.Negate {
+		b.WriteByte('^')
+	}
+	for i, it := range s.Items {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch {
+		case it.Named != 0:
+			esc := it.Named.String()
+			if it.Negate {
+				esc = strings.ToUpper(esc)
+			}
+			b.WriteString(esc)
+			if it.ASCII {
+				b.WriteString(":ascii")
+			}
+		case it.Prop != "":
+			if it.Negate {
+				fmt.Fprintf(&b, `\P{%s}`, it.Prop)
+			} else {
+				fmt.Fprintf(&b, `\p{%s}`, it.Prop)
+			}
+		case it.Lo == it.Hi:
+			b.WriteString(strconv.QuoteRune(it.Lo))
+		default:
+			fmt.Fprintf(&b, "%s-%s", strconv.QuoteRune(it.Lo), strconv.QuoteRune(it.Hi))
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// AsmError reports a problem in assembly source.
+type AsmError struct {
+	Line int
+	Msg  string
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// fixup is a jump operand waiting for its label to be defined.
+type fixup struct {
+	off   int
+	label string
+	line  int
+}
+
+// Assemble translates assembly source into a program for LoadProgram.
+func Assemble(src string) ([]byte, error) {
+	var code []byte
+	labels := make(map[string]int)
+	var fixups []fixup
+
+	for i, text := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		errorf := func(format string, args ...any) error {
+			return &AsmError{Line: lineNo, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		text = strings.TrimSpace(stripComment(text))
+		if colon := strings.IndexByte(text, ':'); colon >= 0 && isLabel(text[:colon]) {
+			name := text[:colon]
+			if _, dup := labels[name]; dup {
+				return nil, errorf("label %s defined twice", name)
+			}
+			labels[name] = len(code)
+			text = strings.TrimSpace(text[colon+1:])
+		}
+		if text == "" {
+			continue
+		}
+
+		mnemonic, rest, _ := strings.Cut(text, " ")
+		op, ok := opByName(mnemonic)
+		if !ok {
+			return nil, errorf("unknown instruction %q", mnemonic)
+		}
+		args := splitOperands(rest)
+		want := operandCount(op)
+		if len(args) != want {
+			return nil, errorf("%s takes %d operands, got %d", mnemonic, want, len(args))
+		}
+
+		target := func(arg string) {
+			fixups = append(fixups, fixup{off: len(code), label: arg, line: lineNo})
+			code = appendU32(code, 0)
+		}
+		number := func(arg string, max int) (int, error) {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n > max {
+				return 0, errorf("invalid operand %q for %s", arg, mnemonic)
+			}
+			return n, nil
+		}
+
+		code = append(code, op)
+		switch op {
+		case OpPush:
+			n, err := number(args[0], 0xff)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, byte(n))
+		case OpChar:
+			r, err := parseRune(args[0])
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			code = appendU32(code, int(r))
+		case OpClass:
+			set, err := parseCharSet(args[0])
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			code = set.Encode(code)
+		case OpSplit:
+			target(args[0])
+			target(args[1])
+		case OpJmp:
+			target(args[0])
+		case OpSave, OpBackref, OpProgress:
+			n, err := number(args[0], 0xffff)
+			if err != nil {
+				return nil, err
+			}
+			code = appendU16(code, n)
+		case OpAssert:
+			kind, ok := assertByName(args[0])
+			if !ok {
+				return nil, errorf("unknown assertion %q", args[0])
+			}
+			code = append(code, kind)
+		case OpLook:
+			switch args[0] {
+			case "pos":
+				code = append(code, 0)
+			case "neg":
+				code = append(code, 1)
+			default:
+				return nil, errorf("look takes pos or neg, got %q", args[0])
+			}
+			target(args[1])
+		}
+	}
+
+	for _, f := range fixups {
+		pc, ok := labels[f.label]
+		if !ok {
+			return nil, &AsmError{Line: f.line, Msg: fmt.Sprintf("undefined label %q", f.label)}
+		}
+		putU32(code, f.off, pc)
+	}
+	return code, nil
+}
+
+func opByName(name string) (byte, bool) {
+	for op, info := range opTable {
+		if info.name == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+func assertByName(name string) (byte, bool) {
+	for kind, n := range assertNames {
+		if n == name {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+func operandCount(op byte) int {
+	switch op {
+	case OpSplit, OpLook:
+		return 2
+	case OpPush, OpChar, OpClass, OpJmp, OpSave, OpBackref, OpProgress, OpAssert:
+		return 1
+	}
+	return 0
+}
+
+func isLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || r == '.' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanQuoted returns the length of the quoted rune at the start of s, or 0.
+func scanQuoted(s string) int {
+	if len(s) < 3 || s[0] != '\'' {
+		return 0
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// stripComment removes a ';' comment, ignoring semicolons in quoted runes.
+func stripComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			if n := scanQuoted(s[i:]); n > 0 {
+				i += n - 1
+			}
+		case ';':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitOperands splits at commas outside quoted runes and class brackets.
+func splitOperands(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			if n := scanQuoted(s[i:]); n > 0 {
+				i += n - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func parseRune(s string) (rune, error) {
+	if scanQuoted(s) != len(s) {
+		return 0, fmt.Errorf("invalid rune %s", s)
+	}
+	r, _, tail, err := strconv.UnquoteChar(s[1:len(s)-1], '\'')
+	if err != nil || tail != "" {
+		return 0, fmt.Errorf("invalid rune %s", s)
+	}
+	return r, nil
+}
+
+// parseCharSet parses a class in the assembly format, as printed by
+// CharSet.String.
+func parseCharSet(s string) (*CharSet, error) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("invalid class %s", s)
+	}
+	body := s[1 : len(s)-1]
+	set := &CharSet{}
+	if strings.HasPrefix(body, "^") {
+		set.Negate = true
+		body = body[1:]
+	}
+	for body = strings.TrimSpace(body); body != ""; body = strings.TrimSpace(body) {
+		var it ClassItem
+		switch {
+		case body[0] == '\'':
+			n := scanQuoted(body)
+			if n == 0 {
+				return nil, fmt.Errorf("invalid class item %s", body)
+			}
+			lo, err := parseRune(body[:n])
+			if err != nil {
+				return nil, err
+			}
+			it.Lo, it.Hi = lo, lo
+			body = body[n:]
+			if strings.HasPrefix(body, "-") {
+				m := scanQuoted(body[1:])
+				if m == 0 {
+					return nil, fmt.Errorf("invalid class range in %s", s)
+				}
+				if it.Hi, err = parseRune(body[1 : 1+m]); err != nil {
+					return nil, err
+				}
+				body = body[1+m:]
+			}
+		case strings.HasPrefix(body, `\p{`) || strings.HasPrefix(body, `\P{`):
+			end := strings.IndexByte(body, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated property in %s", s)
+			}
+			it.Prop, it.Negate = body[3:end], body[1] == 'P'
+			if it.table = UnicodeTable(it.Prop); it.table == nil {
+				return nil, fmt.Errorf("unknown Unicode property %q", it.Prop)
+			}
+			body = body[end+1:]
+		case len(body) >= 2 && body[0] == '\\':
+			for id := ClassDigit; id <= ClassSpace; id++ {
+				esc := id.String()
+				if body[:2] == esc || body[:2] == strings.ToUpper(esc) {
+					it.Named, it.Negate = id, body[:2] != esc
+				}
+			}
+			if it.Named == 0 {
+				return nil, fmt.Errorf("unknown class %s", body[:2])
+			}
+			body = body[2:]
+			if strings.HasPrefix(body, ":ascii") {
+				it.ASCII = true
+				body = body[len(":ascii"):]
+			}
+		default:
+			return nil, fmt.Errorf("invalid class item %s", body)
+		}
+		set.Items = append(set.Items, it)
+	}
+	return set, nil
+}
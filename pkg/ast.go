@@ -1,7 +1,6 @@
 package pkg
 
 import (
-	// "go/ast"
 	"go/token"
 )
 
@@ -20,6 +19,15 @@ type File struct {
 	Imports    []*ImportSpec
 	Unresolved []*Ident
 	Comments   []*CommentGroup
+	// Idents and Lits list every identifier and basic literal in the file,
+	// in source order, including those in function bodies, which Decls
+	// does not model.
+	Idents []*Ident
+	Lits   []*BasicLit
+	// Selectors lists the selected identifier of every selector expression
+	// x.Sel, in source order. Which object it refers to depends on the type
+	// of x, so its Obj is nil.
+	Selectors []*Ident
 }
 
 // Ident represents an identifier
@@ -47,13 +55,33 @@ type Decl interface {
 	declNode()
 }
 
+// FuncDecl represents a function or method declaration
+type FuncDecl struct {
+	Doc    *CommentGroup
+	Func   token.Pos // position of "func"
+	Recv   *Ident    // base type name of a method's receiver; nil for functions
+	Name   *Ident
+	EndPos token.Pos
+}
+
+// GenDecl represents an import, constant, type or variable declaration
+type GenDecl struct {
+	Doc    *CommentGroup
+	TokPos token.Pos
+	Tok    token.Token // token.IMPORT, token.CONST, token.TYPE or token.VAR
+	Names  []*Ident    // the names declared, in order
+	EndPos token.Pos
+}
+
 // Scope represents a lexical scope
 type Scope struct {
 	Outer   *Scope
 	Objects map[string]*Object
 }
 
-// Object represents a declared constant, type, variable, or function
+// Object represents a declared constant, type, variable, or function.
+// Decl is the *FuncDecl or *GenDecl of a package-level object, and the
+// declaring *Ident of any other.
 type Object struct {
 	Kind ObjKind
 	Name string
@@ -62,7 +90,7 @@ type Object struct {
 	Type interface{}
 }
 
-// ObjKind represents the kind of object (const, type, var, func)
+// ObjKind represents the kind of object (const, type, var, func, label)
 type ObjKind int
 
 const (
@@ -72,6 +100,7 @@ const (
 	Typ
 	Var
 	Fun
+	Lbl
 )
 
 // ImportSpec represents an import declaration
@@ -100,3 +129,46 @@ type BasicLit struct {
 	Kind     token.Token
 	Value    string
 }
+
+func (f *FuncDecl) Pos() token.Pos     { return f.Func }
+func (f *FuncDecl) End() token.Pos     { return f.EndPos }
+func (g *GenDecl) Pos() token.Pos      { return g.TokPos }
+func (g *GenDecl) End() token.Pos      { return g.EndPos }
+func (id *Ident) Pos() token.Pos       { return id.NamePos }
+func (id *Ident) End() token.Pos       { return id.NamePos + token.Pos(len(id.Name)) }
+func (lit *BasicLit) Pos() token.Pos   { return lit.ValuePos }
+func (lit *BasicLit) End() token.Pos   { return lit.ValuePos + token.Pos(len(lit.Value)) }
+func (c *Comment) Pos() token.Pos      { return c.Slash }
+func (c *Comment) End() token.Pos      { return c.Slash + token.Pos(len(c.Text)) }
+func (g *CommentGroup) Pos() token.Pos { return g.List[0].Pos() }
+func (g *CommentGroup) End() token.Pos { return g.List[len(g.List)-1].End() }
+func (s *ImportSpec) End() token.Pos   { return s.EndPos }
+func (s *ImportSpec) Pos() token.Pos {
+	if s.Name != nil {
+		return s.Name.Pos()
+	}
+	return s.Path.Pos()
+}
+
+func (*FuncDecl) declNode() {}
+func (*GenDecl) declNode()  {}
+func (*Ident) exprNode()    {}
+func (*BasicLit) exprNode() {}
+
+// Pos returns the position of the name in the object's declaration, or
+// token.NoPos if it is unknown.
+func (obj *Object) Pos() token.Pos {
+	switch d := obj.Decl.(type) {
+	case *FuncDecl:
+		return d.Name.Pos()
+	case *GenDecl:
+		for _, name := range d.Names {
+			if name.Name == obj.Name {
+				return name.Pos()
+			}
+		}
+	case *Ident:
+		return d.Pos()
+	}
+	return token.NoPos
+}
@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// ClassID identifies one of the shorthand character classes (\d, \w, \s).
+// The parser, the matchers and the VM all defer to Contains, so a shorthand
+// means the same thing whichever code path ends up evaluating it.
+type ClassID byte
+
+const (
+	ClassDigit ClassID = iota + 1
+	ClassWord
+	ClassSpace
+)
+
+// Contains reports whether r belongs to the class. With ascii set the class
+// is restricted to its ASCII members, as selected by (?a) or --ascii.
+func (c ClassID) Contains(r rune, ascii bool) bool {
+	switch c {
+	case ClassDigit:
+		return IsDigit(r, ascii)
+	case ClassWord:
+		return IsWord(r, ascii)
+	case ClassSpace:
+		return IsSpace(r, ascii)
+	}
+	return false
+}
+
+// String returns the escape that denotes the class in a pattern.
+func (c ClassID) String() string {
+	switch c {
+	case ClassDigit:
+		return `\d`
+	case ClassWord:
+		return `\w`
+	case ClassSpace:
+		return `\s`
+	}
+	return "?"
+}
+
+// IsDigit reports whether r matches \d: any decimal digit (Nd), or 0-9 in
+// ASCII mode.
+func IsDigit(r rune, ascii bool) bool {
+	if ascii || r < 0x80 {
+		return '0' <= r && r <= '9'
+	}
+	return unicode.IsDigit(r)
+}
+
+// IsWord reports whether r matches \w: letters, marks, decimal digits and
+// connector punctuation such as '_', or [0-9A-Za-z_] in ASCII mode.
+func IsWord(r rune, ascii bool) bool {
+	if ascii || r < 0x80 {
+		return '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+	}
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || unicode.Is(unicode.Pc, r)
+}
+
+// IsSpace reports whether r matches \s: Unicode white space, or
+// [\t\n\v\f\r ] in ASCII mode.
+func IsSpace(r rune, ascii bool) bool {
+	if ascii || r < 0x80 {
+		switch r {
+		case '\t', '\n', '\v', '\f', '\r', ' ':
+			return true
+		}
+		return false
+	}
+	return unicode.IsSpace(r)
+}
+
+// ClassItem is one member of a CharSet: a rune range, a shorthand class or a
+// Unicode property, each optionally negated.
+type ClassItem struct {
+	Lo, Hi rune
+	Named  ClassID
+	Prop   string
+	Negate bool
+	ASCII  bool
+
+	table *unicode.RangeTable
+}
+
+// CharSet is the operand of an OpClass instruction.
+type CharSet struct {
+	Negate bool
+	Items  []ClassItem
+}
+
+// Contains reports whether r is a member of the set.
+func (s *CharSet) Contains(r rune) bool {
+	for i := range s.Items {
+		if s.Items[i].contains(r) {
+			return !s.Negate
+		}
+	}
+	return s.Negate
+}
+
+func (it *ClassItem) contains(r rune) bool {
+	var in bool
+	switch {
+	case it.Named != 0:
+		in = it.Named.Contains(r, it.ASCII)
+	case it.Prop != "":
+		t := it.table
+		if t == nil {
+			t = UnicodeTable(it.Prop)
+		}
+		in = t != nil && unicode.Is(t, r)
+	default:
+		return it.Lo <= r && r <= it.Hi
+	}
+	return in != it.Negate
+}
+
+// Encode appends the operand encoding of s to dst: a flags byte, an item
+// count and then each item tagged with its kind.
+func (s *CharSet) Encode(dst []byte) []byte {
+	var flags byte
+	if s.Negate {
+		flags |= classNegate
+	}
+	dst = append(dst, flags)
+	dst = appendU16(dst, len(s.Items))
+	for _, it := range s.Items {
+		var f byte
+		if it.Negate {
+			f |= classNegate
+		}
+		if it.ASCII {
+			f |= classASCII
+		}
+		switch {
+		case it.Named != 0:
+			dst = append(dst, classNamed, byte(it.Named), f)
+		case it.Prop != "":
+			dst = append(dst, classProp, f, byte(len(it.Prop)))
+			dst = append(dst, it.Prop...)
+		default:
+			dst = append(dst, classRange)
+			dst = appendU32(dst, int(it.Lo))
+			dst = appendU32(dst, int(it.Hi))
+		}
+	}
+	return dst
+}
+
+// DecodeCharSet decodes the class operand at the start of code and returns
+// it with the number of bytes it occupies.
+func DecodeCharSet(code []byte) (*CharSet, int, error) {
+	if len(code) < 3 {
+		return nil, 0, errTruncated
+	}
+	s := &CharSet{Negate: code[0]&classNegate != 0}
+	n := readU16(code, 1)
+	off := 3
+	for i := 0; i < n; i++ {
+		if off >= len(code) {
+			return nil, 0, errTruncated
+		}
+		var it ClassItem
+		switch code[off] {
+		case classRange:
+			if off+9 > len(code) {
+				return nil, 0, errTruncated
+			}
+			it.Lo, it.Hi = rune(readU32(code, off+1)), rune(readU32(code, off+5))
+			off += 9
+		case classNamed:
+			if off+3 > len(code) {
+				return nil, 0, errTruncated
+			}
+			it.Named = ClassID(code[off+1])
+			it.Negate = code[off+2]&classNegate != 0
+			it.ASCII = code[off+2]&classASCII != 0
+			if it.Named < ClassDigit || it.Named > ClassSpace {
+				return nil, 0, fmt.Errorf("unknown class id %d", it.Named)
+			}
+			off += 3
+		case classProp:
+			if off+3 > len(code) || off+3+int(code[off+2]) > len(code) {
+				return nil, 0, errTruncated
+			}
+			it.Negate = code[off+1]&classNegate != 0
+			it.Prop = string(code[off+3 : off+3+int(code[off+2])])
+			if it.table = UnicodeTable(it.Prop); it.table == nil {
+				return nil, 0, fmt.Errorf("unknown Unicode property %q", it.Prop)
+			}
+			off += 3 + len(it.Prop)
+		default:
+			return nil, 0, fmt.Errorf("unknown class item kind %d", code[off])
+		}
+		s.Items = append(s.Items, it)
+	}
+	return s, off, nil
+}
+
+// UnicodeTable returns the table for a Unicode general category or script
+// name as accepted by \p{...}, or nil if the name is unknown.
+func UnicodeTable(name string) *unicode.RangeTable {
+	if t, ok := unicode.Categories[name]; ok {
+		return t
+	}
+	if t, ok := unicode.Scripts[name]; ok {
+		return t
+	}
+	return nil
+}
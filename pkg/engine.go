@@ -2,27 +2,106 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
 	"sync"
 )
 
-// Engine represents the core processing engine
+// ErrStopped is returned by Start when the run was ended early by Stop.
+var ErrStopped = errors.New("engine stopped")
+
+// Engine represents the core processing engine. Tasks run on a bounded pool
+// of workers, started in the order they were added.
 type Engine struct {
-	mu      sync.Mutex
-	running bool
-	tasks   []Task
+	mu       sync.Mutex
+	running  bool
+	tasks    []Task
+	workers  int
+	failFast bool
+	results  chan Result
+
+	// The current run, for Stop and Summary.
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+	summary Summary
+	errs    []error
 }
 
-// Task represents a unit of work to be processed by the engine
+// Task represents a unit of work to be processed by the engine. Tasks may run
+// concurrently with each other when the engine has more than one worker, and
+// should return promptly once ctx is cancelled. They can send values back
+// while they run with Emit.
 type Task interface {
 	Execute(ctx context.Context) error
 }
 
+// Result is a value a task passed to Emit or, with Done set, the outcome of
+// a task that ran.
+type Result struct {
+	// Index is the position of the task in the order tasks were added.
+	Index int
+	Value any
+	Done  bool
+	// Err is the error the task returned, for Done results.
+	Err error
+}
+
+// TaskError is the error returned by one task.
+type TaskError struct {
+	Index int
+	Err   error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %d: %v", e.Index, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// Summary counts what happened to the tasks of a run.
+type Summary struct {
+	Tasks     int
+	Completed int // returned nil
+	Failed    int // returned an error
+	// Skipped tasks were not started, or were cut short by cancellation.
+	Skipped int
+}
+
 // New creates a new instance of the Engine
 func New() *Engine {
 	return &Engine{
-		tasks: make([]Task, 0),
+		tasks:   make([]Task, 0),
+		workers: 1,
+	}
+}
+
+// SetWorkers sets how many tasks may run at once. n <= 0 means one per CPU.
+func (e *Engine) SetWorkers(n int) {
+	if n <= 0 {
+		n = runtime.NumCPU()
 	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.workers = n
+}
+
+// Workers returns how many tasks may run at once.
+func (e *Engine) Workers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.workers
+}
+
+// SetFailFast makes the first task error end the run, as Stop would. By
+// default task errors are collected and the run goes on.
+func (e *Engine) SetFailFast(failFast bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failFast = failFast
 }
 
 // AddTask adds a new task to the engine
@@ -32,39 +111,184 @@ func (e *Engine) AddTask(task Task) {
 	e.tasks = append(e.tasks, task)
 }
 
-// Start begins processing tasks in the engine
+// Results returns a channel carrying the values tasks Emit and a Done result
+// for each task that ran, in the order they happen. It must be called before
+// Start and then drained; Start closes it when the run is over. Without a
+// call to Results, emitted values are dropped.
+func (e *Engine) Results() <-chan Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.results == nil {
+		e.results = make(chan Result, e.workers)
+	}
+	return e.results
+}
+
+type emitKey struct{}
+
+// emitter sends one task's values to the engine's result channel.
+type emitter struct {
+	index   int
+	results chan<- Result
+}
+
+func (em *emitter) send(ctx context.Context, r Result) bool {
+	if em.results == nil {
+		return true
+	}
+	select {
+	case em.results <- r:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Emit sends value to the Results channel of the engine running the task
+// that was given ctx. It blocks until the value is taken and reports false if
+// ctx was cancelled first. Outside an engine run it does nothing.
+func Emit(ctx context.Context, value any) bool {
+	em, ok := ctx.Value(emitKey{}).(*emitter)
+	if !ok {
+		return false
+	}
+	return em.send(ctx, Result{Index: em.index, Value: value})
+}
+
+// Start runs the tasks and waits for them to finish. Task errors are
+// collected (see Errors) and returned joined; with SetFailFast the first one
+// ends the run and is returned alone. If Stop ends the run, Start returns
+// ErrStopped, and if ctx is cancelled, ctx's error. Tasks cut short by
+// cancellation are counted as skipped, not failed.
 func (e *Engine) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	e.mu.Lock()
 	if e.running {
 		e.mu.Unlock()
 		return fmt.Errorf("engine is already running")
 	}
 	e.running = true
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	e.stopped = false
+	e.summary = Summary{Tasks: len(e.tasks)}
+	e.errs = nil
+	tasks, workers, failFast, results, done := e.tasks, e.workers, e.failFast, e.results, e.done
 	e.mu.Unlock()
 
-	for _, task := range e.tasks {
+	defer func() {
+		e.mu.Lock()
+		e.running = false
+		e.cancel = nil
+		e.results = nil
+		e.summary.Skipped = e.summary.Tasks - e.summary.Completed - e.summary.Failed
+		e.mu.Unlock()
+		if results != nil {
+			close(results)
+		}
+		close(done)
+	}()
+
+	type job struct {
+		index int
+		task  Task
+	}
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(tasks)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				if ctx.Err() != nil {
+					// Handed over just as the run was cancelled.
+					continue
+				}
+				em := &emitter{index: j.index, results: results}
+				err := j.task.Execute(context.WithValue(ctx, emitKey{}, em))
+				if err != nil && ctx.Err() != nil {
+					continue
+				}
+				e.finish(j.index, err, failFast)
+				em.send(ctx, Result{Index: j.index, Done: true, Err: err})
+			}
+		}()
+	}
+
+dispatch:
+	for i, task := range tasks {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if err := task.Execute(ctx); err != nil {
-				return fmt.Errorf("task execution failed: %w", err)
-			}
+			break dispatch
+		case queue <- job{i, task}:
 		}
 	}
+	close(queue)
+	wg.Wait()
 
 	e.mu.Lock()
-	e.running = false
+	stopped, errs := e.stopped, e.errs
 	e.mu.Unlock()
+	switch {
+	case stopped:
+		return ErrStopped
+	case failFast && len(errs) > 0:
+		return errs[0]
+	case ctx.Err() != nil:
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
+}
 
-	return nil
+// finish records the outcome of a task that ran to the end.
+func (e *Engine) finish(index int, err error, failFast bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil {
+		e.summary.Completed++
+		return
+	}
+	e.summary.Failed++
+	e.errs = append(e.errs, &TaskError{Index: index, Err: err})
+	if failFast && len(e.errs) == 1 {
+		e.cancel()
+	}
 }
 
-// Stop halts the engine's processing
+// Stop cancels the context of the current run, so no further tasks start,
+// and waits for the tasks already running to return. Their results stand;
+// Summary tells what was done. Stop does nothing when the engine is not
+// running. It must not be called from a Task, which would wait for itself.
 func (e *Engine) Stop() {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.stopped = true
+	cancel, done := e.cancel, e.done
+	e.mu.Unlock()
+
+	cancel()
+	<-done
+}
+
+// Errors returns the task errors of the current or last run, each a
+// *TaskError, in the order they happened.
+func (e *Engine) Errors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]error(nil), e.errs...)
+}
+
+// Summary returns the counts of the current or last run. Skipped is only
+// known once the run is over.
+func (e *Engine) Summary() Summary {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.running = false
+	return e.summary
 }
 
 // IsRunning returns the current running state of the engine
@@ -0,0 +1,343 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// maxVisitedBits caps the memory spent on the visited-state bitmap; larger
+// inputs are searched without memoization.
+const maxVisitedBits = 1 << 25
+
+// Backtrack stack frames are pushed as three ints: kind, a, b.
+const (
+	frameBranch  = iota // resume at pc a, input position b
+	frameRestore        // reset capture slot a to b
+)
+
+var errTruncated = errors.New("truncated instruction")
+
+// progInfo is what Exec needs to know about the loaded regex program. It is
+// computed once per LoadProgram.
+type progInfo struct {
+	size     int
+	slots    int
+	memoize  bool
+	anchored bool
+	classes  map[int]classOp
+}
+
+// classOp is a decoded OpClass instruction.
+type classOp struct {
+	set  *CharSet
+	size int
+}
+
+// Exec runs the loaded regex program over input, trying each start position
+// from pos onwards, and returns the capture slots of the leftmost match or
+// nil if there is none. Slots that did not participate hold -1. Input may
+// hold several lines: ^ and $ match around newlines and no class or . ever
+// consumes one, so a match stays within a line.
+func (vm *VM) Exec(input []byte, pos int) ([]int, error) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+
+	if vm.running {
+		return nil, fmt.Errorf("VM is already running")
+	}
+	if vm.prog == nil {
+		info, err := analyze(vm.memory)
+		if err != nil {
+			return nil, err
+		}
+		vm.prog = info
+	}
+
+	vm.running = true
+	defer func() { vm.running = false }()
+
+	info := vm.prog
+	memoize := info.memoize && info.size*(len(input)+1) <= maxVisitedBits
+	if memoize {
+		words := (info.size*(len(input)+1) + 31) / 32
+		if cap(vm.visited) < words {
+			vm.visited = make([]uint32, words)
+		}
+		vm.visited = vm.visited[:words]
+		for i := range vm.visited {
+			vm.visited[i] = 0
+		}
+	}
+
+	caps := make([]int, info.slots)
+	vm.steps = 0
+	for start := pos; start <= len(input); {
+		if start > pos && input[start-1] == '\n' {
+			vm.steps = 0
+		}
+		for i := range caps {
+			caps[i] = -1
+		}
+		vm.stack = vm.stack[:0]
+		ok, err := vm.backtrack(input, 0, start, caps, memoize)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return caps, nil
+		}
+
+		if info.anchored {
+			next := bytes.IndexByte(input[start:], '\n')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+			continue
+		}
+		if start == len(input) {
+			break
+		}
+		_, size := utf8.DecodeRune(input[start:])
+		start += size
+	}
+	return nil, nil
+}
+
+// backtrack runs one thread from pc at input position pos, exploring
+// alternatives depth first until one reaches OpMatch or OpLookEnd.
+func (vm *VM) backtrack(input []byte, pc, pos int, caps []int, memoize bool) (bool, error) {
+	info := vm.prog
+	code := vm.memory[:info.size]
+	base := len(vm.stack)
+	vm.stack = append(vm.stack, frameBranch, pc, pos)
+
+	for len(vm.stack) > base {
+		n := len(vm.stack)
+		kind, a, b := vm.stack[n-3], vm.stack[n-2], vm.stack[n-1]
+		vm.stack = vm.stack[:n-3]
+		if kind == frameRestore {
+			caps[a] = b
+			continue
+		}
+		pc, pos = a, b
+
+	thread:
+		for pc < len(code) {
+			if memoize {
+				bit := pc*(len(input)+1) + pos
+				if vm.visited[bit/32]&(1<<(bit%32)) != 0 {
+					break thread
+				}
+				vm.visited[bit/32] |= 1 << (bit % 32)
+			}
+			if err := vm.step(pc, pos, len(vm.stack)/3); err != nil {
+				return false, err
+			}
+			if vm.tracer != nil {
+				vm.tracer.Step(pc, pos)
+			}
+
+			switch op := code[pc]; op {
+			case OpNop:
+				pc++
+			case OpChar:
+				r, size := utf8.DecodeRune(input[pos:])
+				if pos >= len(input) || r != rune(readU32(code, pc+1)) {
+					break thread
+				}
+				pos += size
+				pc += 5
+			case OpAny:
+				r, size := utf8.DecodeRune(input[pos:])
+				if pos >= len(input) || r == '\n' {
+					break thread
+				}
+				pos += size
+				pc++
+			case OpClass:
+				r, size := utf8.DecodeRune(input[pos:])
+				class := info.classes[pc]
+				if pos >= len(input) || r == '\n' || !class.set.Contains(r) {
+					break thread
+				}
+				pos += size
+				pc += class.size
+			case OpSplit:
+				vm.stack = append(vm.stack, frameBranch, readU32(code, pc+5), pos)
+				if vm.tracer != nil {
+					vm.tracer.Spawn(readU32(code, pc+5), pos)
+				}
+				pc = readU32(code, pc+1)
+			case OpJmp:
+				pc = readU32(code, pc+1)
+			case OpSave:
+				slot := readU16(code, pc+1)
+				vm.stack = append(vm.stack, frameRestore, slot, caps[slot])
+				caps[slot] = pos
+				if vm.tracer != nil {
+					vm.tracer.Save(slot, pos)
+				}
+				pc += 3
+			case OpMatch, OpLookEnd:
+				vm.stack = vm.stack[:base]
+				if op == OpMatch && vm.tracer != nil {
+					vm.tracer.Match(caps)
+				}
+				return true, nil
+			case OpAssert:
+				if !assert(code[pc+1], input, pos) {
+					break thread
+				}
+				pc += 2
+			case OpBackref:
+				group := readU16(code, pc+1)
+				lo, hi := caps[2*group], caps[2*group+1]
+				if lo < 0 || hi < lo || len(input)-pos < hi-lo || string(input[pos:pos+hi-lo]) != string(input[lo:hi]) {
+					break thread
+				}
+				pos += hi - lo
+				pc += 3
+			case OpLook:
+				negate := code[pc+1] != 0
+				saved := append([]int(nil), caps...)
+				ok, err := vm.backtrack(input, pc+6, pos, caps, false)
+				if err != nil {
+					return false, err
+				}
+				if negate {
+					copy(caps, saved)
+					ok = !ok
+				}
+				if !ok {
+					break thread
+				}
+				// The body's own frames are gone; keep its captures undoable.
+				for i := range caps {
+					if caps[i] != saved[i] {
+						vm.stack = append(vm.stack, frameRestore, i, saved[i])
+					}
+				}
+				pc = readU32(code, pc+2)
+			case OpProgress:
+				if !memoize && caps[readU16(code, pc+1)] == pos {
+					break thread
+				}
+				pc += 3
+			default:
+				return false, fmt.Errorf("unknown opcode: 0x%02x at offset %d", op, pc)
+			}
+		}
+		if vm.tracer != nil {
+			vm.tracer.Kill(pc, pos)
+		}
+	}
+	return false, nil
+}
+
+func assert(kind byte, input []byte, pos int) bool {
+	switch kind {
+	case AssertBegin:
+		return pos == 0 || input[pos-1] == '\n'
+	case AssertEnd:
+		return pos == len(input) || input[pos] == '\n'
+	case AssertWordBoundary, AssertNoWordBoundary:
+		return atWordBoundary(input, pos, false) == (kind == AssertWordBoundary)
+	case AssertWordBoundaryASCII, AssertNoWordBoundaryASCII:
+		return atWordBoundary(input, pos, true) == (kind == AssertWordBoundaryASCII)
+	}
+	return false
+}
+
+func atWordBoundary(input []byte, pos int, ascii bool) bool {
+	before, after := false, false
+	if pos > 0 {
+		r, _ := utf8.DecodeLastRune(input[:pos])
+		before = IsWord(r, ascii)
+	}
+	if pos < len(input) {
+		r, _ := utf8.DecodeRune(input[pos:])
+		after = IsWord(r, ascii)
+	}
+	return before != after
+}
+
+// analyze walks the program once, decoding classes and collecting the
+// properties Exec relies on.
+func analyze(code []byte) (*progInfo, error) {
+	info := &progInfo{memoize: true, classes: make(map[int]classOp)}
+	first := true
+	for pc := 0; pc < len(code); {
+		size, err := instrLen(code, pc)
+		if err != nil {
+			return nil, fmt.Errorf("%v at offset %d", err, pc)
+		}
+		switch code[pc] {
+		case OpSave, OpProgress:
+			if slot := readU16(code, pc+1); slot >= info.slots {
+				info.slots = slot + 1
+			}
+		case OpBackref:
+			if slots := 2*readU16(code, pc+1) + 2; slots > info.slots {
+				info.slots = slots
+			}
+			info.memoize = false
+		case OpLook:
+			info.memoize = false
+		case OpClass:
+			set, _, _ := DecodeCharSet(code[pc+1:])
+			info.classes[pc] = classOp{set: set, size: size}
+		}
+		if first && code[pc] != OpSave {
+			info.anchored = code[pc] == OpAssert && code[pc+1] == AssertBegin
+			first = false
+		}
+		pc += size
+		if code[pc-size] != OpNop {
+			info.size = pc
+		}
+	}
+	return info, nil
+}
+
+// instrLen returns the encoded length of the instruction at pc.
+func instrLen(code []byte, pc int) (int, error) {
+	info, ok := opTable[code[pc]]
+	if !ok {
+		return 0, fmt.Errorf("unknown opcode: 0x%02x", code[pc])
+	}
+	if code[pc] == OpClass {
+		_, n, err := DecodeCharSet(code[pc+1:])
+		if err != nil {
+			return 0, err
+		}
+		return 1 + n, nil
+	}
+	if pc+info.size > len(code) {
+		return 0, errTruncated
+	}
+	return info.size, nil
+}
+
+func readU16(code []byte, off int) int {
+	return int(binary.LittleEndian.Uint16(code[off:]))
+}
+
+func readU32(code []byte, off int) int {
+	return int(binary.LittleEndian.Uint32(code[off:]))
+}
+
+func appendU16(dst []byte, v int) []byte {
+	return binary.LittleEndian.AppendUint16(dst, uint16(v))
+}
+
+func appendU32(dst []byte, v int) []byte {
+	return binary.LittleEndian.AppendUint32(dst, uint32(v))
+}
+
+func putU32(dst []byte, off, v int) {
+	binary.LittleEndian.PutUint32(dst[off:], uint32(v))
+}
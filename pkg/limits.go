@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors wrapped by LimitError, for errors.Is.
+var (
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrStackLimit = errors.New("stack limit exceeded")
+)
+
+// Limits bounds the work of a VM, so that programs from untrusted patterns
+// cannot run away with CPU or memory. Zero fields mean no limit.
+type Limits struct {
+	// MaxSteps bounds the instructions run by one Run call, or by Exec for
+	// each line of its input, counting every start position and every
+	// alternative tried.
+	MaxSteps int
+	// MaxStack bounds the values on the stack during Run, and the pending
+	// alternatives and capture undo records during Exec.
+	MaxStack int
+}
+
+// LimitError is returned by Run and Exec when a limit was exceeded. Err is
+// ErrStepLimit or ErrStackLimit.
+type LimitError struct {
+	Err   error
+	Limit int
+	PC    int // offset of the instruction that was about to run
+	// Pos is the input position of the thread in Exec, -1 in Run. Exec
+	// counts steps by line, so the limit was exceeded on the line
+	// containing Pos.
+	Pos int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v (limit %d) at offset %d", e.Err, e.Limit, e.PC)
+}
+
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// SetLimits applies l to later runs of the VM.
+func (vm *VM) SetLimits(l Limits) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	vm.limits = l
+}
+
+// step counts the instruction at pc against the limits before it runs, with
+// the thread at input position pos; stack is the current stack size in the
+// unit of Limits.MaxStack, or 0 when the caller checks the stack itself.
+func (vm *VM) step(pc, pos, stack int) error {
+	if vm.limits.MaxSteps > 0 {
+		vm.steps++
+		if vm.steps > vm.limits.MaxSteps {
+			return &LimitError{ErrStepLimit, vm.limits.MaxSteps, pc, pos}
+		}
+	}
+	if vm.limits.MaxStack > 0 && stack > vm.limits.MaxStack {
+		return &LimitError{ErrStackLimit, vm.limits.MaxStack, pc, pos}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pkg
+
+// Stack machine instructions, run by VM.Run.
+const (
+	OpNop  byte = 0x00 // do nothing
+	OpPush byte = 0x01 // value u8: push the operand
+	OpPop  byte = 0x02 // discard the top of the stack
+	OpAdd  byte = 0x03 // replace the two top values with their sum
+	OpSub  byte = 0x04 // replace the two top values with their difference
+	OpHalt byte = 0x05 // stop the program
+)
+
+// Regex instructions, run by VM.Exec. Operands follow the opcode byte and are little-endian;
+// jump targets are absolute offsets into the program.
+const (
+	OpChar     byte = 0x10 // rune u32: consume one rune equal to the operand
+	OpAny      byte = 0x11 // consume any rune except '\n'
+	OpClass    byte = 0x12 // class: consume one rune in the encoded class (see DecodeClass)
+	OpSplit    byte = 0x13 // x u32, y u32: continue at x, backtrack to y
+	OpJmp      byte = 0x14 // x u32: continue at x
+	OpSave     byte = 0x15 // slot u16: record the input position in a capture slot
+	OpMatch    byte = 0x16 // report a match
+	OpAssert   byte = 0x17 // kind u8: zero-width assertion (Assert*)
+	OpBackref  byte = 0x18 // group u16: consume the text captured by a group
+	OpLook     byte = 0x19 // negate u8, end u32: run the body that follows as a lookahead, then continue at end
+	OpLookEnd  byte = 0x1A // end of a lookahead body
+	OpProgress byte = 0x1B // slot u16: fail unless the input advanced since the slot was saved
+)
+
+// Assertion kinds for OpAssert.
+const (
+	AssertBegin byte = iota + 1
+	AssertEnd
+	AssertWordBoundary
+	AssertNoWordBoundary
+	AssertWordBoundaryASCII
+	AssertNoWordBoundaryASCII
+)
+
+// Class item kinds used in the OpClass encoding.
+const (
+	classRange byte = iota // lo u32, hi u32
+	classNamed             // id u8, flags u8 (classNegate, classASCII)
+	classProp              // flags u8 (classNegate), len u8, name
+)
+
+// Class item flags.
+const (
+	classNegate byte = 1 << iota
+	classASCII
+)
+
+// opInfo describes an instruction for instrLen, the assembler and the
+// disassembler.
+type opInfo struct {
+	name string
+	size int // including the opcode; 0 for OpClass, whose operand varies
+}
+
+var opTable = map[byte]opInfo{
+	OpNop:      {"nop", 1},
+	OpPush:     {"push", 2},
+	OpPop:      {"pop", 1},
+	OpAdd:      {"add", 1},
+	OpSub:      {"sub", 1},
+	OpHalt:     {"halt", 1},
+	OpChar:     {"char", 5},
+	OpAny:      {"any", 1},
+	OpClass:    {"class", 0},
+	OpSplit:    {"split", 9},
+	OpJmp:      {"jmp", 5},
+	OpSave:     {"save", 3},
+	OpMatch:    {"match", 1},
+	OpAssert:   {"assert", 2},
+	OpBackref:  {"backref", 3},
+	OpLook:     {"look", 6},
+	OpLookEnd:  {"lookend", 1},
+	OpProgress: {"progress", 3},
+}
+
+// assertNames are the assembly names of the OpAssert kinds.
+var assertNames = map[byte]string{
+	AssertBegin:               "begin",
+	AssertEnd:                 "end",
+	AssertWordBoundary:        "boundary",
+	AssertNoWordBoundary:      "noboundary",
+	AssertWordBoundaryASCII:   "boundary-ascii",
+	AssertNoWordBoundaryASCII: "noboundary-ascii",
+}
@@ -0,0 +1,26 @@
+package pkg
+
+// Tracer receives the events of a VM run, for debugging programs. Positions
+// are byte offsets into the input given to Exec.
+type Tracer interface {
+	// Step is called before the instruction at pc runs with the thread at
+	// input position pos. Run passes -1 for pos.
+	Step(pc, pos int)
+	// Spawn is called when a split leaves an alternative thread to resume
+	// at pc and pos if the current one fails.
+	Spawn(pc, pos int)
+	// Kill is called when the thread at pc and pos fails, including a
+	// lookahead body that does not match.
+	Kill(pc, pos int)
+	// Save is called when a thread records pos in capture slot slot.
+	Save(slot, pos int)
+	// Match is called with the capture slots of the match Exec returns.
+	Match(caps []int)
+}
+
+// SetTracer makes the VM report its runs to t; nil turns tracing off.
+func (vm *VM) SetTracer(t Tracer) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	vm.tracer = t
+}
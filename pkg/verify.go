@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// VerifyError reports the first problem Verify found in a program.
+type VerifyError struct {
+	Offset int // offset of the offending instruction
+	Msg    string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Msg)
+}
+
+// Verify checks that program can be run by VM.Run or VM.Exec without reading
+// past its end or executing anything but whole instructions. It rejects
+//
+//   - unknown opcodes and instructions whose operands are cut off;
+//   - stack and regex instructions mixed in one program;
+//   - pop, add and sub that would find too few values on the stack;
+//   - unknown assertion kinds;
+//   - jumps to anything but an instruction start or the end of the program;
+//   - lookaheads whose body does not end with lookend right before the end
+//     target, lookend outside a lookahead body, and jumps into or out of a
+//     lookahead body.
+//
+// Nop may appear in either kind of program.
+func Verify(program []byte) error {
+	var starts []int
+	var kind byte // OpPush for a stack program, OpChar for a regex one
+	depth, halted := 0, false
+	for pc := 0; pc < len(program); {
+		size, err := instrLen(program, pc)
+		if err != nil {
+			if errors.Is(err, errTruncated) {
+				err = fmt.Errorf("%s operand truncated", opTable[program[pc]].name)
+			}
+			return &VerifyError{pc, err.Error()}
+		}
+		op := program[pc]
+		if op != OpNop {
+			k := OpChar
+			if op < OpChar {
+				k = OpPush
+			}
+			if kind == 0 {
+				kind = k
+			} else if k != kind {
+				return &VerifyError{pc, fmt.Sprintf("%s in a %s program", opTable[op].name, kindName(kind))}
+			}
+		}
+
+		// Run executes a stack program straight through to the first halt.
+		if !halted {
+			need, delta := 0, 0
+			switch op {
+			case OpPush:
+				delta = 1
+			case OpPop:
+				need, delta = 1, -1
+			case OpAdd, OpSub:
+				need, delta = 2, -1
+			case OpHalt:
+				halted = true
+			}
+			if depth < need {
+				return &VerifyError{pc, fmt.Sprintf("%s needs %d values on the stack, has %d", opTable[op].name, need, depth)}
+			}
+			depth += delta
+		}
+
+		if op == OpAssert {
+			if _, ok := assertNames[program[pc+1]]; !ok {
+				return &VerifyError{pc, fmt.Sprintf("unknown assertion kind %d", program[pc+1])}
+			}
+		}
+		starts = append(starts, pc)
+		pc += size
+	}
+	return verifyJumps(program, starts)
+}
+
+func kindName(kind byte) string {
+	if kind == OpPush {
+		return "stack"
+	}
+	return "regex"
+}
+
+// verifyJumps checks jump targets and the nesting of lookahead bodies. Each
+// instruction belongs to the innermost lookahead body around it, or to the
+// top level (-1); a jump must stay within its own body.
+func verifyJumps(program []byte, starts []int) error {
+	type look struct{ pc, end int }
+	var open []look
+	body := make(map[int]int, len(starts)) // instruction -> offset of its OpLook
+	for _, pc := range starts {
+		for len(open) > 0 && pc >= open[len(open)-1].end {
+			open = open[:len(open)-1]
+		}
+		region := -1
+		if len(open) > 0 {
+			region = open[len(open)-1].pc
+		}
+		body[pc] = region
+
+		switch program[pc] {
+		case OpLook:
+			end := readU32(program, pc+2)
+			if end <= pc+6 {
+				return &VerifyError{pc, fmt.Sprintf("lookahead end %d leaves no room for a body", end)}
+			}
+			if len(open) > 0 && end > open[len(open)-1].end {
+				return &VerifyError{pc, fmt.Sprintf("lookahead end %d is outside the enclosing body", end)}
+			}
+			open = append(open, look{pc, end})
+		case OpLookEnd:
+			if region < 0 {
+				return &VerifyError{pc, "lookend outside a lookahead body"}
+			}
+		}
+	}
+	body[len(program)] = -1
+
+	for _, pc := range starts {
+		targets := jumpTargets(program, pc)
+		for _, t := range targets {
+			i := sort.SearchInts(starts, t)
+			if t != len(program) && (i == len(starts) || starts[i] != t) {
+				return &VerifyError{pc, fmt.Sprintf("jump target %d is not an instruction", t)}
+			}
+		}
+		if program[pc] == OpLook {
+			// The body ends with lookend, and the end target is back in the
+			// region of the lookahead itself.
+			end := targets[0]
+			i := sort.SearchInts(starts, end)
+			if program[starts[i-1]] != OpLookEnd || body[starts[i-1]] != pc {
+				return &VerifyError{pc, fmt.Sprintf("lookahead body does not end with lookend before %d", end)}
+			}
+			if body[end] != body[pc] {
+				return &VerifyError{pc, fmt.Sprintf("lookahead end %d is outside the enclosing body", end)}
+			}
+			continue
+		}
+		for _, t := range targets {
+			if body[t] != body[pc] {
+				return &VerifyError{pc, fmt.Sprintf("jump to %d crosses a lookahead body", t)}
+			}
+		}
+	}
+	return nil
+}
@@ -12,6 +12,14 @@ type VM struct {
 	stack   []int
 	mutex   sync.Mutex
 	running bool
+
+	// prog and visited serve Exec when the memory holds a regex program.
+	prog    *progInfo
+	visited []uint32
+
+	tracer Tracer
+	limits Limits
+	steps  int // instructions run against Limits.MaxSteps
 }
 
 // NewVM creates a new virtual machine with the given memory size
@@ -35,26 +43,36 @@ func (vm *VM) Run() error {
 	vm.running = true
 	defer func() { vm.running = false }()
 
+	vm.steps = 0
 	for vm.pc < len(vm.memory) {
+		if err := vm.step(vm.pc, -1, 0); err != nil {
+			return err
+		}
+		if vm.tracer != nil {
+			vm.tracer.Step(vm.pc, -1)
+		}
 		opcode := vm.memory[vm.pc]
 		vm.pc++
 
 		switch opcode {
-		case 0x00: // NOP
+		case OpNop:
 			// Do nothing
-		case 0x01: // PUSH
+		case OpPush:
 			if vm.pc >= len(vm.memory) {
 				return fmt.Errorf("unexpected end of memory")
 			}
+			if vm.limits.MaxStack > 0 && len(vm.stack) >= vm.limits.MaxStack {
+				return &LimitError{ErrStackLimit, vm.limits.MaxStack, vm.pc - 1, -1}
+			}
 			value := int(vm.memory[vm.pc])
 			vm.pc++
 			vm.stack = append(vm.stack, value)
-		case 0x02: // POP
+		case OpPop:
 			if len(vm.stack) == 0 {
 				return fmt.Errorf("stack underflow")
 			}
 			vm.stack = vm.stack[:len(vm.stack)-1]
-		case 0x03: // ADD
+		case OpAdd:
 			if len(vm.stack) < 2 {
 				return fmt.Errorf("not enough operands for ADD")
 			}
@@ -62,7 +80,7 @@ func (vm *VM) Run() error {
 			b := vm.stack[len(vm.stack)-1]
 			vm.stack = vm.stack[:len(vm.stack)-2]
 			vm.stack = append(vm.stack, a+b)
-		case 0x04: // SUB
+		case OpSub:
 			if len(vm.stack) < 2 {
 				return fmt.Errorf("not enough operands for SUB")
 			}
@@ -70,7 +88,7 @@ func (vm *VM) Run() error {
 			b := vm.stack[len(vm.stack)-1]
 			vm.stack = vm.stack[:len(vm.stack)-2]
 			vm.stack = append(vm.stack, a-b)
-		case 0x05: // HALT
+		case OpHalt:
 			return nil
 		default:
 			return fmt.Errorf("unknown opcode: 0x%02x", opcode)
@@ -80,7 +98,7 @@ func (vm *VM) Run() error {
 	return nil
 }
 
-// LoadProgram loads a program into the VM's memory
+// LoadProgram verifies a program (see Verify) and loads it into the VM's memory
 func (vm *VM) LoadProgram(program []byte) error {
 	vm.mutex.Lock()
 	defer vm.mutex.Unlock()
@@ -88,8 +106,15 @@ func (vm *VM) LoadProgram(program []byte) error {
 	if len(program) > len(vm.memory) {
 		return fmt.Errorf("program size exceeds memory size")
 	}
+	if err := Verify(program); err != nil {
+		return err
+	}
 
-	copy(vm.memory, program)
+	// Clear what an earlier, longer program left: Run and Exec read the
+	// whole memory, and zeros are nops.
+	n := copy(vm.memory, program)
+	clear(vm.memory[n:])
+	vm.prog = nil
 	return nil
 }
 
@@ -0,0 +1,286 @@
+package matcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/compiler"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+func TestAssemblerRoundTrip(t *testing.T) {
+	patterns := []string{
+		`^(?P<w>\w+)\s+[^a-z\d;]x*?(?!foo)\1$`,
+		`(a|b)*c{2,3}`,
+		`(?a)\b\p{Greek}[\P{L}\W' ]\B`,
+		`(?:x?)*y+?(?=z)`,
+		`[\]\[;,'\\-]+`,
+	}
+	for _, pattern := range patterns {
+		re, err := parser.Parse(pattern, 0)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", pattern, err)
+		}
+		c := compiler.GrepCompiler{KeepSpans: true}
+		prog, err := c.Compile(re)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", pattern, err)
+		}
+
+		listing, err := pkg.Disassemble(prog.Code, prog.Comment)
+		if err != nil {
+			t.Fatalf("Disassemble(%q): %v", pattern, err)
+		}
+		code, err := pkg.Assemble(listing)
+		if err != nil {
+			t.Fatalf("Assemble(%q): %v\n%s", pattern, err, listing)
+		}
+		if !bytes.Equal(code, prog.Code) {
+			t.Errorf("%q: assembled listing differs from the compiled program\n%s", pattern, listing)
+		}
+	}
+}
+
+func TestAssembleAndRun(t *testing.T) {
+	code, err := pkg.Assemble(`
+        save 0
+loop:   split body, done        ; (ab)*
+body:   char 'a'
+        class ['b'-'c' \d]
+        jmp loop
+done:   assert end
+        save 1
+        match
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := pkg.NewVM(len(code))
+	if err := vm.LoadProgram(code); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := vm.Exec([]byte("xxa1abac"), 0)
+	if err != nil || caps == nil || caps[0] != 2 || caps[1] != 8 {
+		t.Errorf("Exec = %v, %v; want a match at [2 8]", caps, err)
+	}
+
+	code, err = pkg.Assemble("push 2\npush 40\nadd\nhalt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = pkg.NewVM(len(code))
+	vm.LoadProgram(code)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if top, _ := vm.GetStackTop(); top != 42 {
+		t.Errorf("stack top = %d, want 42", top)
+	}
+
+	// A shorter program must not run into what the last one left behind.
+	vm = pkg.NewVM(16)
+	for _, src := range []string{"push 1\npush 2\npush 3\nadd\nadd\nhalt", "push 2\npush 40"} {
+		code, err = pkg.Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.LoadProgram(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if top, _ := vm.GetStackTop(); top != 40 {
+		t.Errorf("after reloading, stack top = %d, want 40", top)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"save 0\njmp nowhere\nmatch", 2},
+		{"save 0\n\nfrob 3", 3},
+		{"split a", 1},
+		{"x: match\nx: match", 2},
+		{"char 'ab'", 1},
+		{"class ['a' \\q]", 1},
+		{"assert sideways", 1},
+		{"save 70000", 1},
+	}
+	for _, tc := range tests {
+		_, err := pkg.Assemble(tc.src)
+		var asmErr *pkg.AsmError
+		if !errors.As(err, &asmErr) || asmErr.Line != tc.line {
+			t.Errorf("Assemble(%q) = %v, want an error on line %d", tc.src, err, tc.line)
+		}
+	}
+}
+
+func TestDumpProgram(t *testing.T) {
+	listing, err := matcher.DumpProgram(`a(b|c)`, matcher.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"split L1, L2", "char 'b'", "; 2-5 `b|c`"} {
+		if !bytes.Contains([]byte(listing), []byte(want)) {
+			t.Errorf("listing lacks %q:\n%s", want, listing)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	asm := func(src string) []byte {
+		code, err := pkg.Assemble(src)
+		if err != nil {
+			t.Fatalf("Assemble(%q): %v", src, err)
+		}
+		return code
+	}
+	tests := []struct {
+		name    string
+		program []byte
+		offset  int // -1 if the program is valid
+	}{
+		{"stack program", asm("push 1\npush 2\nsub\npop\nhalt\npop"), -1},
+		{"regex program", asm("save 0\nlook neg, end\nchar 'a'\nlookend\nend: save 1\nmatch"), -1},
+		{"unknown opcode", []byte{pkg.OpPush, 1, 0x7f}, 2},
+		{"truncated push", []byte{pkg.OpNop, pkg.OpPush}, 1},
+		{"truncated jump", []byte{pkg.OpMatch, pkg.OpJmp, 0, 0}, 1},
+		{"truncated class", []byte{pkg.OpClass, 0, 1}, 0},
+		{"stack underflow", asm("push 1\nadd\nhalt"), 2},
+		{"pop on empty stack", asm("nop\npop"), 1},
+		{"mixed program", asm("push 1\nmatch"), 2},
+		{"jump past the end", []byte{pkg.OpJmp, 9, 0, 0, 0, pkg.OpMatch}, 0},
+		{"jump into an operand", []byte{pkg.OpJmp, 2, 0, 0, 0, pkg.OpMatch}, 0},
+		{"unknown assertion", []byte{pkg.OpAssert, 42}, 0},
+		{"lookend at top level", asm("save 0\nlookend"), 3},
+		{"look without lookend", asm("look pos, end\nchar 'a'\nend: match"), 0},
+		{"jump into a look body", asm("jmp in\nlook pos, end\nin: char 'a'\nlookend\nend: match"), 0},
+		{"jump out of a look body", asm("look pos, end\njmp end\nlookend\nend: match"), 6},
+	}
+	for _, tc := range tests {
+		err := pkg.Verify(tc.program)
+		var verr *pkg.VerifyError
+		switch {
+		case tc.offset < 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.offset >= 0 && (!errors.As(err, &verr) || verr.Offset != tc.offset):
+			t.Errorf("%s: got %v, want an error at offset %d", tc.name, err, tc.offset)
+		}
+	}
+
+	vm := pkg.NewVM(16)
+	if err := vm.LoadProgram([]byte{pkg.OpPush}); err == nil {
+		t.Errorf("LoadProgram accepted a truncated program")
+	}
+}
+
+// eventTracer records VM events as strings.
+type eventTracer struct{ events []string }
+
+func (e *eventTracer) Step(pc, pos int) {
+	e.events = append(e.events, fmt.Sprintf("step %d@%d", pc, pos))
+}
+func (e *eventTracer) Spawn(pc, pos int) {
+	e.events = append(e.events, fmt.Sprintf("spawn %d@%d", pc, pos))
+}
+func (e *eventTracer) Kill(pc, pos int) {
+	e.events = append(e.events, fmt.Sprintf("kill %d@%d", pc, pos))
+}
+func (e *eventTracer) Save(slot, pos int) {
+	e.events = append(e.events, fmt.Sprintf("save %d=%d", slot, pos))
+}
+func (e *eventTracer) Match(caps []int) { e.events = append(e.events, fmt.Sprintf("match %v", caps)) }
+
+func TestTracer(t *testing.T) {
+	code, err := pkg.Assemble(`
+        save 0          ; 0
+        split a, b      ; 3
+a:      char 'x'        ; 12
+b:      char 'y'        ; 17
+        save 1          ; 22
+        match           ; 25
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := pkg.NewVM(len(code))
+	if err := vm.LoadProgram(code); err != nil {
+		t.Fatal(err)
+	}
+	var tr eventTracer
+	vm.SetTracer(&tr)
+	if caps, err := vm.Exec([]byte("y"), 0); err != nil || caps == nil {
+		t.Fatalf("Exec = %v, %v", caps, err)
+	}
+	want := []string{
+		"step 0@0", "save 0=0", "step 3@0", "spawn 17@0", "step 12@0", "kill 12@0",
+		"step 17@0", "step 22@1", "save 1=1", "step 25@1", "match [0 1]",
+	}
+	if fmt.Sprint(tr.events) != fmt.Sprint(want) {
+		t.Errorf("events\n%v\nwant\n%v", tr.events, want)
+	}
+
+	var out strings.Builder
+	matched, err := matcher.TraceMatch(`a(b)`, []byte("xab"), matcher.Options{}, &out)
+	if err != nil || !matched {
+		t.Fatalf("TraceMatch = %v, %v", matched, err)
+	}
+	for _, want := range []string{"fail at pc 3, pos 0", "group 1 start = 2", `group 1 "b" at 2-3`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("trace lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	code, err := pkg.Assemble("push 1\npush 2\npush 3\nadd\nadd\nhalt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		limits pkg.Limits
+		want   error
+		pc     int
+	}{
+		{pkg.Limits{MaxSteps: 6}, nil, 0},
+		{pkg.Limits{MaxSteps: 4}, pkg.ErrStepLimit, 7},
+		{pkg.Limits{MaxStack: 3}, nil, 0},
+		{pkg.Limits{MaxStack: 2}, pkg.ErrStackLimit, 4},
+	}
+	for _, tc := range tests {
+		vm := pkg.NewVM(len(code))
+		vm.LoadProgram(code)
+		vm.SetLimits(tc.limits)
+		err := vm.Run()
+		var limit *pkg.LimitError
+		switch {
+		case tc.want == nil && err != nil:
+			t.Errorf("%+v: unexpected error %v", tc.limits, err)
+		case tc.want != nil && (!errors.Is(err, tc.want) || !errors.As(err, &limit) || limit.PC != tc.pc):
+			t.Errorf("%+v: got %v, want %v at offset %d", tc.limits, err, tc.want, tc.pc)
+		}
+	}
+
+	// Without memoization (a backreference) this pattern backtracks
+	// exponentially on a run of a's.
+	m, err := matcher.NewRegexMatcherWithOptions(`(a|aa)*(x)?\2c|ok`, matcher.Options{Limits: pkg.Limits{MaxSteps: 10000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte(strings.Repeat("a", 40) + "\nok\n")
+	if loc := m.FindIndex(buf, 0); loc == nil || loc[0] != 41 {
+		t.Errorf("FindIndex = %v, want the match on the second line at 41", loc)
+	}
+	if !errors.Is(m.Err(), pkg.ErrStepLimit) {
+		t.Errorf("Err = %v, want ErrStepLimit", m.Err())
+	}
+}
@@ -0,0 +1,92 @@
+package matcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/compiler"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/parser"
+)
+
+func TestProgramEncoding(t *testing.T) {
+	re, err := parser.Parse(`(?a)(?<word>\w+)-(x|y)\1`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c compiler.GrepCompiler
+	prog, err := c.Compile(re)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := prog.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got compiler.Program
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if !reflect.DeepEqual(&got, prog) {
+		t.Errorf("decoded %+v, want %+v", got, *prog)
+	}
+
+	damaged := append([]byte(nil), data...)
+	damaged[len(damaged)/2] ^= 0x40
+	if err := got.UnmarshalBinary(damaged); !errors.Is(err, compiler.ErrFormat) {
+		t.Errorf("damaged program: got %v, want ErrFormat", err)
+	}
+	if err := got.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, compiler.ErrFormat) {
+		t.Errorf("truncated program: got %v, want ErrFormat", err)
+	}
+	old := append([]byte(nil), data...)
+	old[4]++
+	if err := got.UnmarshalBinary(old); !errors.Is(err, compiler.ErrVersion) {
+		t.Errorf("other version: got %v, want ErrVersion", err)
+	}
+}
+
+func TestRegexMatcherPatterns(t *testing.T) {
+	patterns := []string{`(a)\1`, `(b)(c)\2`, `^d(?<e>e)?$`}
+	dir := t.TempDir()
+	key := compiler.Hash("(a)\\1\n(b)(c)\\2\n^d(?<e>e)?$", 0)
+
+	check := func(stage string) {
+		t.Helper()
+		m, err := matcher.NewRegexMatcherPatterns(patterns, matcher.Options{CacheDir: dir})
+		if err != nil {
+			t.Fatalf("%s: %v", stage, err)
+		}
+		tests := map[string]bool{"aa": true, "ab": false, "bcc": true, "bcb": false, "de": true, "xd": false}
+		for input, want := range tests {
+			if got := m.Match([]byte(input), ""); got != want {
+				t.Errorf("%s: Match(%q) = %v, want %v", stage, input, got, want)
+			}
+		}
+	}
+
+	check("compiled")
+	path := filepath.Join(dir, key+".prog")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("program not cached: %v", err)
+	}
+	check("cached")
+
+	// A damaged entry is compiled again and replaced.
+	if err := os.WriteFile(path, data[:10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check("recompiled")
+	if again, _ := os.ReadFile(path); len(again) != len(data) {
+		t.Errorf("damaged cache entry not replaced")
+	}
+
+	if _, err := matcher.NewRegexMatcherPatterns([]string{"a", "(?a)b"}, matcher.Options{}); err == nil {
+		t.Errorf("patterns disagreeing on (?a) were accepted")
+	}
+}
@@ -0,0 +1,279 @@
+package matcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/search"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+type funcTask func(ctx context.Context) error
+
+func (f funcTask) Execute(ctx context.Context) error { return f(ctx) }
+
+func TestEngineWorkers(t *testing.T) {
+	engine := pkg.New()
+	engine.SetWorkers(3)
+
+	var running, peak, done atomic.Int32
+	for i := 0; i < 20; i++ {
+		engine.AddTask(funcTask(func(ctx context.Context) error {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			done.Add(1)
+			return nil
+		}))
+	}
+
+	if err := engine.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if done.Load() != 20 {
+		t.Errorf("ran %d tasks, want 20", done.Load())
+	}
+	if peak.Load() > 3 {
+		t.Errorf("%d tasks ran at once, want at most 3", peak.Load())
+	}
+	if engine.IsRunning() {
+		t.Errorf("engine still running after Start returned")
+	}
+}
+
+func TestEngineFailFast(t *testing.T) {
+	engine := pkg.New()
+	engine.SetWorkers(2)
+	engine.SetFailFast(true)
+	boom := errors.New("boom")
+
+	var started atomic.Int32
+	engine.AddTask(funcTask(func(ctx context.Context) error { return boom }))
+	for i := 0; i < 100; i++ {
+		engine.AddTask(funcTask(func(ctx context.Context) error {
+			started.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+	}
+
+	err := engine.Start(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("Start returned %v, want %v", err, boom)
+	}
+	if started.Load() > 2 {
+		t.Errorf("%d tasks started after the failure", started.Load())
+	}
+}
+
+func TestEngineResults(t *testing.T) {
+	engine := pkg.New()
+	engine.SetWorkers(4)
+	missing := errors.New("missing")
+	for i := 0; i < 10; i++ {
+		engine.AddTask(funcTask(func(ctx context.Context) error {
+			for j := 0; j < 3; j++ {
+				pkg.Emit(ctx, i*10+j)
+			}
+			if i%3 == 0 {
+				return missing
+			}
+			return nil
+		}))
+	}
+
+	results := engine.Results()
+	errc := make(chan error, 1)
+	go func() { errc <- engine.Start(context.Background()) }()
+
+	values := make(map[int][]int)
+	doneErrs := 0
+	for r := range results {
+		if r.Done {
+			if r.Err != nil {
+				doneErrs++
+			}
+			continue
+		}
+		values[r.Index] = append(values[r.Index], r.Value.(int))
+	}
+
+	err := <-errc
+	if !errors.Is(err, missing) {
+		t.Errorf("Start returned %v, want the joined task errors", err)
+	}
+	for i := 0; i < 10; i++ {
+		if got, want := fmt.Sprint(values[i]), fmt.Sprint([]int{i * 10, i*10 + 1, i*10 + 2}); got != want {
+			t.Errorf("task %d emitted %s, want %s", i, got, want)
+		}
+	}
+	if doneErrs != 4 || len(engine.Errors()) != 4 {
+		t.Errorf("got %d failed results and %d errors, want 4", doneErrs, len(engine.Errors()))
+	}
+	var te *pkg.TaskError
+	if !errors.As(engine.Errors()[0], &te) || te.Index%3 != 0 {
+		t.Errorf("Errors()[0] = %v, want a *TaskError of a failing task", engine.Errors()[0])
+	}
+	want := pkg.Summary{Tasks: 10, Completed: 6, Failed: 4}
+	if got := engine.Summary(); got != want {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSearchFilesOrdered(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 30; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%02d", i))
+		// Earlier files are larger so they tend to finish last.
+		content := bytes.Repeat([]byte("filler line\n"), (30-i)*200)
+		content = append(content, fmt.Sprintf("hit %d\n", i)...)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	rm, err := matcher.NewRegexMatcher(`hit \d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	var out bytes.Buffer
+	s := search.New(rm, `hit \d+`, &out, search.Options{
+		WithFilename: true,
+		ReportError: func(name string, err error) {
+			errs = append(errs, name)
+		},
+	})
+
+	sum, err := s.SearchFiles(context.Background(), paths, 4, false)
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if want := (search.Summary{Searched: 31, Matched: 30, Errored: 1, Selected: 30}); sum != want {
+		t.Errorf("Summary = %+v, want %+v", sum, want)
+	}
+
+	var want bytes.Buffer
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&want, "%s:hit %d\n", paths[i], i)
+	}
+	if out.String() != want.String() {
+		t.Errorf("output not in path order:\n%s", out.String())
+	}
+	if len(errs) != 1 || errs[0] != paths[30] {
+		t.Errorf("reported errors for %v, want %s", errs, paths[30])
+	}
+}
+
+func TestSearchFilesSARIF(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%02d", i))
+		content := bytes.Repeat([]byte("filler line\n"), (20-i)*200)
+		content = append(content, strings.Repeat("hit ", i%3+1)+"\n"...)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	rm, err := matcher.NewRegexMatcher(`hit`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := search.New(rm, `hit`, &out, search.Options{Format: search.FormatSARIF})
+	sum, err := s.SearchFiles(context.Background(), paths, 4, false)
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if want := (search.Summary{Searched: 20, Matched: 20, Selected: 20, Matches: 39}); sum != want {
+		t.Errorf("Summary = %+v, want %+v", sum, want)
+	}
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("%v in:\n%s", err, out.String())
+	}
+	var got, want []string
+	for i, path := range paths {
+		for j := 0; j <= i%3; j++ {
+			want = append(want, "file://"+filepath.ToSlash(path))
+		}
+	}
+	for _, res := range log.Runs[0].Results {
+		got = append(got, res.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("results not in path order:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestEngineStop(t *testing.T) {
+	engine := pkg.New()
+	engine.SetWorkers(2)
+
+	var started atomic.Int32
+	running := make(chan struct{}, 2)
+	engine.AddTask(funcTask(func(ctx context.Context) error { return nil }))
+	for i := 0; i < 100; i++ {
+		engine.AddTask(funcTask(func(ctx context.Context) error {
+			started.Add(1)
+			running <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- engine.Start(context.Background()) }()
+	<-running
+	<-running
+	engine.Stop()
+
+	if engine.IsRunning() {
+		t.Errorf("engine still running after Stop returned")
+	}
+	if err := <-errc; !errors.Is(err, pkg.ErrStopped) {
+		t.Errorf("Start returned %v, want %v", err, pkg.ErrStopped)
+	}
+	if started.Load() != 2 {
+		t.Errorf("%d tasks started, want the 2 in flight", started.Load())
+	}
+	want := pkg.Summary{Tasks: 101, Completed: 1, Skipped: 100}
+	if got := engine.Summary(); got != want {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+	engine.Stop() // not running: no-op
+}
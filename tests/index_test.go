@@ -0,0 +1,208 @@
+package matcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/index"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+)
+
+func indexQuery(t *testing.T, patterns ...string) *index.Query {
+	t.Helper()
+	re, err := matcher.ParsePatterns(patterns, matcher.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index.RegexpQuery(re)
+}
+
+func TestRegexpQuery(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{`hello`, `(hel ell llo)`},
+		{`ab`, `+`},
+		{`.*`, `+`},
+		{`foo|bar`, `(bar|foo)`},
+		{`abc\d+xyz`, `(abc xyz)`},
+		{`gr[ae]y`, `((gra ray)|(gre rey))`},
+		{`(abc)?def`, `((abc bcd cde def)|def)`},
+		{`x(abc)+y`, `abc`},
+	}
+	for _, tc := range tests {
+		if got := indexQuery(t, tc.pattern).String(); got != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.pattern, tc.expected, got)
+		}
+	}
+}
+
+func TestIndexFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "the quick brown fox\n",
+		"b.txt":         "jumps over\nthe lazy dog\n",
+		"sub/c.txt":     "quick\n",
+		"sub/utf16.txt": "\xff\xfeq\x00",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.Build(root); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := index.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{`quick`, []string{"a.txt", "sub/c.txt", "sub/utf16.txt"}},
+		{`lazy|fox`, []string{"a.txt", "b.txt", "sub/utf16.txt"}},
+		// Trigrams spanning lines are not indexed.
+		{`over the`, []string{"sub/utf16.txt"}},
+		{`\w`, []string{"a.txt", "b.txt", "sub/c.txt", "sub/utf16.txt"}},
+	}
+	for _, tc := range tests {
+		var want []string
+		for _, name := range tc.expected {
+			want = append(want, filepath.Join(root, filepath.FromSlash(name)))
+		}
+		if got := ix.Files(indexQuery(t, tc.pattern)); !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", tc.pattern, want, got)
+		}
+	}
+
+	if _, err := index.Open(t.TempDir()); err == nil {
+		t.Error("Open of a directory without an index succeeded")
+	}
+}
+
+func TestIndexUpdateMerge(t *testing.T) {
+	root := t.TempDir()
+	segments := func() int {
+		t.Helper()
+		segs, err := filepath.Glob(filepath.Join(root, index.Dir, "seg-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(segs)
+	}
+	update := func(i int) {
+		t.Helper()
+		name := filepath.Join(root, fmt.Sprintf("f%d.txt", i))
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("file %d\n", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := index.Update(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := index.Build(root); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < index.MaxSegments; i++ {
+		update(i)
+	}
+	if got := segments(); got != index.MaxSegments {
+		t.Fatalf("expected %d segments, found %d", index.MaxSegments, got)
+	}
+	update(index.MaxSegments)
+	if got := segments(); got != 1 {
+		t.Errorf("expected the %d segments to be merged into one, found %d", index.MaxSegments, got)
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string, age time.Duration) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := func(pattern string) []string {
+		t.Helper()
+		ix, err := index.Open(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, path := range ix.Files(indexQuery(t, pattern)) {
+			rel, _ := filepath.Rel(root, path)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return names
+	}
+
+	write("a.txt", "alpha\n", time.Hour)
+	write("b.txt", "bravo\n", time.Hour)
+	write("c.txt", "charlie\n", time.Hour)
+	if err := index.Build(root); err != nil {
+		t.Fatal(err)
+	}
+
+	write("a.txt", "alpha delta\n", 0) // changed
+	write("b.txt", "bravo\n", 0)       // touched only
+	if err := os.Remove(filepath.Join(root, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	write("d.txt", "delta\n", 0) // added
+	st, err := index.Update(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (index.Stats{Added: 1, Changed: 1, Removed: 1}); st != want {
+		t.Errorf("expected %+v, got %+v", want, st)
+	}
+	if got, want := files("delta"), []string{"a.txt", "d.txt"}; !slices.Equal(got, want) {
+		t.Errorf("delta: expected %v, got %v", want, got)
+	}
+	if got := files("charlie"); got != nil {
+		t.Errorf("charlie: expected no files, got %v", got)
+	}
+	if got, want := files("bravo"), []string{"b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("bravo: expected %v, got %v", want, got)
+	}
+
+	// Enough updates to merge the segments.
+	for i := 0; i < 6; i++ {
+		write("d.txt", fmt.Sprintf("delta %d\n", i), time.Duration(i)*time.Minute)
+		if _, err := index.Update(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := files("delta 5"), []string{"d.txt"}; !slices.Equal(got, want) {
+		t.Errorf("delta 5: expected %v, got %v", want, got)
+	}
+	if got, want := files("alpha|bravo|delta"), []string{"a.txt", "b.txt", "d.txt"}; !slices.Equal(got, want) {
+		t.Errorf("alpha|bravo|delta: expected %v, got %v", want, got)
+	}
+	segs, _ := filepath.Glob(filepath.Join(root, index.Dir, "seg-*"))
+	if len(segs) > index.MaxSegments {
+		t.Errorf("expected the segments to be merged, found %d", len(segs))
+	}
+	if st, err := index.Update(root); err != nil || st != (index.Stats{}) {
+		t.Errorf("update of an unchanged tree: %+v, %v", st, err)
+	}
+}
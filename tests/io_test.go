@@ -0,0 +1,301 @@
+package matcher
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	grepio "github.com/codecrafters-io/grep-starter-go/internal/io"
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/search"
+)
+
+// oneByteReader hands out a single byte per Read to exercise refills.
+type oneByteReader struct{ r *strings.Reader }
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	return o.r.Read(p[:1])
+}
+
+func TestLineReaderLongLines(t *testing.T) {
+	long := strings.Repeat("x", 300*1024)
+	input := "short\n" + long + "\nlast"
+
+	lr, err := grepio.ReadLines(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadLines: %v", err)
+	}
+
+	want := []struct {
+		text   string
+		offset int64
+	}{
+		{"short", 0},
+		{long, 6},
+		{"last", int64(7 + len(long))},
+	}
+	for i, w := range want {
+		if !lr.Next() {
+			t.Fatalf("line %d: Next returned false: %v", i, lr.Err())
+		}
+		if string(lr.Line()) != w.text {
+			t.Errorf("line %d: got %d bytes, want %d", i, len(lr.Line()), len(w.text))
+		}
+		if lr.Offset() != w.offset {
+			t.Errorf("line %d: offset %d, want %d", i, lr.Offset(), w.offset)
+		}
+	}
+	if lr.Next() {
+		t.Errorf("expected end of input, got %q", lr.Line())
+	}
+	if err := lr.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLineReaderSmallReads(t *testing.T) {
+	lr := grepio.NewLineReader(oneByteReader{strings.NewReader("a\n\nbc\n")})
+	var got [][]byte
+	for lr.Next() {
+		got = append(got, append([]byte(nil), lr.Line()...))
+	}
+	want := [][]byte{[]byte("a"), {}, []byte("bc")}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("line %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	const text = "abcabcabcabcabcabc needle\nother line\n"
+
+	var gz, zl bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(text))
+	gw.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(text))
+	zw.Close()
+	// The same text as written by compress(1).
+	dotZ := []byte{
+		0x1f, 0x9d, 0x90, 0x61, 0xc4, 0x8c, 0x09, 0x38, 0x50, 0x20, 0xc1, 0x83,
+		0x02, 0x41, 0xb8, 0x29, 0x53, 0x86, 0x0c, 0x9b, 0x32, 0x0a, 0xde, 0xd0,
+		0x41, 0x53, 0x46, 0x0e, 0x08, 0x36, 0x69, 0x16, 0x2a, 0x00,
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		kind  grepio.Compression
+	}{
+		{"plain", []byte(text), grepio.Uncompressed},
+		{"gzip", gz.Bytes(), grepio.Gzip},
+		{"zlib", zl.Bytes(), grepio.Zlib},
+		{"compress", dotZ, grepio.LZW},
+		{"text resembling zlib", []byte("x^2 + y\n"), grepio.Uncompressed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, kind, err := grepio.Decompress(bytes.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("Decompress: %v", err)
+			}
+			if kind != tc.kind {
+				t.Errorf("detected %v, want %v", kind, tc.kind)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if tc.kind != grepio.Uncompressed && string(got) != text {
+				t.Errorf("got %q, want %q", got, text)
+			}
+		})
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	corrupt := []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 'x', 'y', 'z'}
+	r, _, err := grepio.Decompress(bytes.NewReader(corrupt))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if err == nil {
+		t.Errorf("expected an error for a corrupt gzip stream")
+	}
+}
+
+func TestWalkArchive(t *testing.T) {
+	files := []struct{ name, body string }{
+		{"a.txt", "alpha\n"},
+		{"dir/b.txt", "a much longer member body\n"},
+	}
+
+	var tb, zb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	zw := zip.NewWriter(&zb)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.body))
+		w, _ := zw.Create(f.name)
+		w.Write([]byte(f.body))
+	}
+	tw.Close()
+	zw.Close()
+
+	walk := func(r io.Reader, kind grepio.Archive, maxSize int64) ([]string, error) {
+		var got []string
+		err := grepio.WalkArchive(r, kind, maxSize, func(path string, r io.Reader, err error) {
+			if err != nil {
+				got = append(got, path+": "+err.Error())
+				return
+			}
+			body, _ := io.ReadAll(r)
+			got = append(got, path+"="+string(body))
+		})
+		return got, err
+	}
+	want := []string{"a.txt=alpha\n", "dir/b.txt: " + grepio.ErrMemberTooLarge.Error()}
+
+	// A zip is read from the file itself, whatever its size.
+	zipFile := filepath.Join(t.TempDir(), "a.zip")
+	if err := os.WriteFile(zipFile, zb.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, r := range []io.Reader{bytes.NewReader(tb.Bytes()), f} {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(r, head)
+		kind := grepio.DetectArchive(head[:n])
+		if kind == grepio.NotArchive {
+			t.Fatalf("archive not detected")
+		}
+		r.(io.Seeker).Seek(0, io.SeekStart)
+
+		got, err := walk(r, kind, 10)
+		if err != nil {
+			t.Fatalf("WalkArchive(%v): %v", kind, err)
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("archive %v: got %q, want %q", kind, got, want)
+		}
+	}
+
+	// A zip that is not a file is buffered, up to the member cap.
+	if _, err := walk(bytes.NewReader(zb.Bytes()), grepio.Zip, 10); !errors.Is(err, grepio.ErrMemberTooLarge) {
+		t.Errorf("buffered zip over the cap: got %v, want ErrMemberTooLarge", err)
+	}
+	got, err := walk(bytes.NewReader(zb.Bytes()), grepio.Zip, int64(zb.Len()))
+	if err != nil || len(got) != 2 || got[1] != "dir/b.txt=a much longer member body\n" {
+		t.Errorf("buffered zip within the cap: got %q, %v", got, err)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		isBin bool
+	}{
+		{"ASCII text", "hello\nworld\n", false},
+		{"UTF-8 text", "naïve café\n", false},
+		{"NUL byte", "ELF\x00\x01", true},
+		{"invalid UTF-8", "caf\xe9 au lait", true},
+		{"character cut at buffer end", "caf\xc3", false},
+	}
+	for _, tc := range tests {
+		if got := grepio.IsBinary([]byte(tc.data)); got != tc.isBin {
+			t.Errorf("%s: IsBinary = %v, want %v", tc.name, got, tc.isBin)
+		}
+	}
+}
+
+func TestTranscodeOffsets(t *testing.T) {
+	// "héllo\nwörld\n" as UTF-16LE with a byte order mark.
+	var utf16le []byte
+	utf16le = append(utf16le, 0xff, 0xfe)
+	for _, r := range "héllo\nwörld\n" {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		enc     grepio.Encoding
+		lines   []string
+		offsets []int64
+	}{
+		{"UTF-16LE BOM", utf16le, grepio.EncodingAuto, []string{"héllo", "wörld"}, []int64{2, 14}},
+		{"UTF-8 BOM", []byte("\xef\xbb\xbfab\ncd\n"), grepio.EncodingAuto, []string{"ab", "cd"}, []int64{3, 6}},
+		{"Latin-1", []byte("caf\xe9\nna\xefve\n"), grepio.Latin1, []string{"café", "naïve"}, []int64{0, 5}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := grepio.Transcode(bytes.NewReader(tc.input), tc.enc)
+			if err != nil {
+				t.Fatalf("Transcode: %v", err)
+			}
+			lr := grepio.NewLineReader(r)
+			for i := range tc.lines {
+				if !lr.Next() {
+					t.Fatalf("line %d missing: %v", i, lr.Err())
+				}
+				if string(lr.Line()) != tc.lines[i] || lr.Offset() != tc.offsets[i] {
+					t.Errorf("line %d: got %q at %d, want %q at %d",
+						i, lr.Line(), lr.Offset(), tc.lines[i], tc.offsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchArchive(t *testing.T) {
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	for _, f := range []struct{ name, body string }{{"a.txt", "alpha\n"}, {"b.txt", "beta\n"}} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+
+	rm, err := matcher.NewRegexMatcher("alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts    search.Options
+		members bool
+	}{
+		// Without -z the archive is searched as a plain file.
+		{search.Options{}, false},
+		{search.Options{Decompress: true, ArchiveDepth: 1}, true},
+		{search.Options{Decompress: true, ArchiveDepth: 0}, false},
+	}
+	for _, tc := range tests {
+		var out bytes.Buffer
+		matched, err := search.New(rm, "alpha", &out, tc.opts).Search(bytes.NewReader(tb.Bytes()), "in")
+		if err != nil || !matched {
+			t.Fatalf("%+v: matched %v, error %v", tc.opts, matched, err)
+		}
+		if got := out.String() == "in!a.txt:alpha\n"; got != tc.members {
+			t.Errorf("%+v: got %q", tc.opts, out.String())
+		}
+	}
+}
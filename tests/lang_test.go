@@ -0,0 +1,228 @@
+package matcher
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/lang"
+	"github.com/codecrafters-io/grep-starter-go/internal/search"
+	"github.com/codecrafters-io/grep-starter-go/pkg"
+)
+
+const goSource = `// Package demo has a TODO in its doc.
+package demo
+
+import (
+	"fmt"
+	u "net/url"
+)
+
+/* block comment
+   with a TODO inside */
+const site = "https://example.com/TODO" // TODO: fix
+
+type Engine struct{}
+
+func TODO(e *Engine) {
+	s := site
+	fmt.Println(u.QueryEscape(s), ` + "`raw\nTODO string`" + `)
+}
+`
+
+func TestParseGo(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := lang.ParseGo(fset, "demo.go", []byte(goSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name.Name != "demo" || len(f.Imports) != 2 || f.Imports[1].Name.Name != "u" || f.Imports[1].Path.Value != `"net/url"` {
+		t.Errorf("package %v, imports %v", f.Name, f.Imports)
+	}
+	if len(f.Comments) != 3 || len(f.Decls) != 4 {
+		t.Errorf("%d comment groups and %d decls, want 3 and 4", len(f.Comments), len(f.Decls))
+	}
+
+	engine := f.Scope.Objects["Engine"]
+	if engine == nil || engine.Kind != pkg.Typ {
+		t.Fatalf("Engine = %+v, want a type", engine)
+	}
+	if decl, ok := engine.Decl.(*pkg.GenDecl); !ok || decl.Tok != token.TYPE {
+		t.Errorf("Engine declared by %T", engine.Decl)
+	}
+	if fn := f.Scope.Objects["TODO"]; fn == nil || fn.Kind != pkg.Fun || fset.Position(fn.Pos()).Line != 15 {
+		t.Errorf("TODO = %+v, want a func declared on line 15", fn)
+	}
+
+	// References share the declaration's object; locals are resolved too.
+	var refs, locals int
+	for _, id := range f.Idents {
+		switch {
+		case id.Obj == engine:
+			refs++
+		case id.Name == "s" && id.Obj != nil && id.Obj.Kind == pkg.Var:
+			if _, ok := id.Obj.Decl.(*pkg.Ident); ok {
+				locals++
+			}
+		}
+	}
+	if refs != 2 || locals != 2 {
+		t.Errorf("%d uses of Engine and %d of s, want 2 and 2", refs, locals)
+	}
+	var unresolved []string
+	for _, id := range f.Unresolved {
+		unresolved = append(unresolved, id.Name)
+	}
+	if len(unresolved) != 2 || unresolved[0] != "fmt" || unresolved[1] != "u" {
+		t.Errorf("unresolved %v, want [fmt u]", unresolved)
+	}
+}
+
+func TestSearchRegions(t *testing.T) {
+	tests := []struct {
+		only, pattern, want string
+	}{
+		{"comments", "TODO", "1:// Package demo has a TODO in its doc.\n10:   with a TODO inside */\n11:const site = \"https://example.com/TODO\" // TODO: fix\n"},
+		{"strings", "TODO", "11:const site = \"https://example.com/TODO\" // TODO: fix\n18:TODO string`)\n"},
+		{"idents", "TODO|url", "15:func TODO(e *Engine) {\n"},
+		{"imports", "url", "6:\tu \"net/url\"\n"},
+		{"comments", `^const`, ""},
+	}
+	for _, tc := range tests {
+		kinds, err := lang.ParseKinds(tc.only)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := searchString(t, tc.pattern, goSource, search.Options{
+			LineNumber: true,
+			Regions: func(_ string, src []byte) ([]lang.Span, error) {
+				return lang.Regions("go", src, kinds)
+			},
+		})
+		if got != tc.want {
+			t.Errorf("--only %s %q:\n%s\nwant:\n%s", tc.only, tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestSearchRegionsTranscoded(t *testing.T) {
+	// UTF-16LE with a byte order mark: the comment starts at byte 2+2*10.
+	input := []byte{0xFF, 0xFE}
+	for _, c := range "package p\n// TODO x\nvar TODO = 1\n" {
+		input = append(input, byte(c), 0)
+	}
+	regions := func(_ string, src []byte) ([]lang.Span, error) {
+		return lang.Regions("go", src, lang.Comments)
+	}
+	got := searchString(t, "TODO", string(input), search.Options{ByteOffset: true, Regions: regions})
+	if want := "22:// TODO x\n"; got != want {
+		t.Errorf("-b: got %q, want %q", got, want)
+	}
+	got = searchString(t, "TODO", string(input), search.Options{Format: search.FormatJSON, Regions: regions})
+	if !strings.Contains(got, `"absolute_offset":22,`) || !strings.Contains(got, `"start":3,"end":7`) || strings.Contains(got, "var") {
+		t.Errorf("JSON: got\n%s", got)
+	}
+}
+
+func TestIdentRegions(t *testing.T) {
+	spanLines := func(src string, spans []lang.Span, kind lang.Kind) []int {
+		var out []int
+		for _, sp := range spans {
+			if sp.Kind == kind {
+				out = append(out, 1+strings.Count(src[:sp.Start], "\n"))
+			}
+		}
+		return out
+	}
+	methods := "package p\n\ntype Engine struct{}\n\nfunc (e *Engine) Start() {}\n\nfunc Start() { new(Engine).Start() }\n"
+	shadowed := "package p\n\nvar x = 1\n\nfunc f() {\n\tx := 2\n\t_ = x\n}\n\nfunc g() int { return x }\n"
+	tests := []struct {
+		src, name  string
+		line       int
+		kinds      string
+		idents     []int
+		unresolved []int
+	}{
+		{goSource, "Engine", 0, "", []int{13, 15}, nil},
+		{goSource, "Engine", 0, "type|func", []int{13, 15}, nil},
+		{goSource, "Engine", 0, "func", nil, nil},
+		{goSource, "s", 0, "var", []int{16, 17}, nil},
+		{goSource, "site", 0, "const", []int{11, 16}, nil},
+		{goSource, "fmt", 0, "var", nil, []int{17}},
+		{goSource, "fmt", 0, "type", nil, nil},
+		// The function, not the method, is the package-level object; the
+		// call of the method is a selection.
+		{methods, "Start", 0, "func", []int{7}, []int{7}},
+		{methods, "Start", 5, "func", []int{5}, []int{7}},
+		{methods, "Start", 0, "type", nil, nil},
+		// A local that shadows x is a different object.
+		{shadowed, "x", 0, "", []int{3, 10}, nil},
+		{shadowed, "x", 7, "", []int{6, 7}, nil},
+	}
+	for _, tc := range tests {
+		kinds, err := lang.ParseObjKinds(tc.kinds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, err := lang.IdentRegions([]byte(tc.src), tc.name, tc.line, kinds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, gotUnresolved := spanLines(tc.src, spans, lang.Idents), spanLines(tc.src, spans, lang.Unresolved)
+		if fmt.Sprint(got) != fmt.Sprint(tc.idents) || fmt.Sprint(gotUnresolved) != fmt.Sprint(tc.unresolved) {
+			t.Errorf("%s:%d %s: lines %v, unresolved %v; want %v, %v", tc.name, tc.line, tc.kinds, got, gotUnresolved, tc.idents, tc.unresolved)
+		}
+	}
+
+	twice := "package p\n\nfunc f() { y := 1; _ = y }\n\nfunc g() { y := 2; _ = y }\n"
+	if _, err := lang.IdentRegions([]byte(twice), "y", 0, nil); err == nil {
+		t.Errorf("IdentRegions picked one of two locals named y")
+	}
+	if _, err := lang.IdentRegions([]byte(twice), "y", 4, nil); err == nil {
+		t.Errorf("IdentRegions found y on a blank line")
+	}
+	if _, err := lang.ParseObjKinds("func|method"); err == nil {
+		t.Errorf("ParseObjKinds accepted an unknown kind")
+	}
+}
+
+func TestLexRegions(t *testing.T) {
+	tests := []struct {
+		language, src string
+		want          []string // comments, strings and code, in order
+	}{
+		{"python", "x = 'a#b' # c\nd = \"\"\"e\nf\"\"\"\n",
+			[]string{"code:x = ", "strings:'a#b'", "code: ", "comments:# c", "code:\nd = ", "strings:\"\"\"e\nf\"\"\"", "code:\n"}},
+		{"shell", "echo $# 'a\nb' \"c\\\"\"#x # y",
+			[]string{"code:echo $# ", "strings:'a\nb'", "code: ", "strings:\"c\\\"\"", "code:#x ", "comments:# y"}},
+		{"c", "a /* b */ '\\'' // c\n\"d",
+			[]string{"code:a ", "comments:/* b */", "code: ", "strings:'\\''", "code: ", "comments:// c", "code:\n", "strings:\"d"}},
+		{"yaml", "a: it's # b\nc: 'd''e'\n",
+			[]string{"code:a: it's ", "comments:# b", "code:\nc: ", "strings:'d''e'", "code:\n"}},
+		{"sql", "select 'a''b' -- c\n/* d",
+			[]string{"code:select ", "strings:'a''b'", "code: ", "comments:-- c", "code:\n", "comments:/* d"}},
+	}
+	for _, tc := range tests {
+		spans, err := lang.Regions(tc.language, []byte(tc.src), lang.Comments|lang.Strings|lang.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, sp := range spans {
+			got = append(got, sp.Kind.String()+":"+tc.src[sp.Start:sp.End])
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.language, got, tc.want)
+		}
+	}
+
+	if _, err := lang.Regions("python", []byte("x"), lang.Idents); err == nil {
+		t.Errorf("idents regions of Python were accepted")
+	}
+	for name, want := range map[string]string{"a/b.PY": "python", "x.yml": "yaml", "x.h": "c", "README": ""} {
+		if got := lang.Detect(name); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package matcher
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -19,7 +20,7 @@ func TestRegexMatcher(t *testing.T) {
 		{"Literal match", "hello", "hello", true},
 		{"Literal mismatch", "hello", "hella", false},
 		{"Dot wildcard match", "h3llo", "h.llo", true},
-		{"Dot wildcard mismatch", "hlllo", "h.llo", false},
+		{"Dot wildcard mismatch", "hllo", "h.llo", false},
 
 		// Character Classes
 		{"Positive char class match", "a", "[abc]", true},
@@ -82,7 +83,7 @@ func TestAdvancedRegexPatterns(t *testing.T) {
         pattern  string
         expected bool
     }{
-        {"Complex alternation", "abcdefg", "a(b|c|d){3}g", true},
+        {"Complex alternation", "abcdefg", "a(b|c|d){3}g", false},
         {"Nested quantifiers", "aaaabbbbbcccccc", "(a+b+c+){1,2}", true},
         {"Lookahead", "hello world", "hello(?=\\sworld)", true},
         {"Negative lookahead", "hello universe", "hello(?!\\sworld)", true},
@@ -90,7 +91,7 @@ func TestAdvancedRegexPatterns(t *testing.T) {
         {"Non-word boundaries", "helloworld", "hello\\Bworld", true},
         {"Backreference with quantifier", "catcatcat", "(cat)\\1+", true},
         {"Complex character class", "a1B2c3D4", "[a-z][0-9][A-Z][0-9][a-z][0-9]", true},
-        {"Negated character class", "A1b2C3", "[^a-z][^A-Z][^0-9]{2}", true},
+        {"Negated character class", "A1b2C3", "[^a-z][^A-Z][^0-9]{2}", false},
         {"Unicode support", "こんにちは世界", "\\p{Hiragana}+\\p{Han}+", true},
     }
 
@@ -189,3 +190,74 @@ func TestRegexMatcherInvalidPatterns(t *testing.T) {
         })
     }
 }
+
+func TestRegexClassSemantics(t *testing.T) {
+    tests := []struct {
+        name     string
+        text     string
+        pattern  string
+        ascii    bool
+        expected bool
+    }{
+        {"Unicode digit", "٣", "\\d", false, true},
+        {"ASCII digit flag", "٣", "(?a)\\d", false, false},
+        {"ASCII digit option", "٣", "\\d", true, false},
+        {"Unicode word", "é", "^\\w$", false, true},
+        {"ASCII word", "é", "^\\w$", true, false},
+        {"Non-digit", "abc", "\\D", false, true},
+        {"Non-word", "héllo", "\\W", false, false},
+        {"Non-word ASCII", "héllo", "\\W", true, true},
+        {"Space", "a\tb", "a\\sb", false, true},
+        {"Unicode space", "a b", "a\\sb", false, true},
+        {"ASCII space", "a b", "a\\sb", true, false},
+        {"Non-space", "a b", "a\\Sb", false, false},
+        {"Class escape in brackets", "x٣", "^x[\\d]$", false, true},
+        {"Unicode word boundary", "naïve", "\\bnaïve\\b", false, true},
+        {"ASCII word boundary", "naïve", "na\\b", true, true},
+        {"Non-word boundary", "naïve", "na\\B", false, true},
+    }
+
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            rm, err := matcher.NewRegexMatcherWithOptions(tc.pattern, matcher.Options{ASCII: tc.ascii})
+            if err != nil {
+                t.Fatalf("Failed to create RegexMatcher: %v", err)
+            }
+            result := rm.Match([]byte(tc.text), tc.pattern)
+            if result != tc.expected {
+                t.Errorf("Pattern: '%s' Text: '%s' ASCII: %v Expected: %v, Got: %v",
+                    tc.pattern, tc.text, tc.ascii, tc.expected, result)
+            }
+        })
+    }
+}
+
+func TestRegexFindIndex(t *testing.T) {
+    buf := []byte("alpha 1\nbeta 22\ngamma\nbeta 333\n")
+    tests := []struct {
+        name     string
+        pattern  string
+        from     int
+        expected []int
+    }{
+        {"Literal prefilter", "beta \\d+", 0, []int{8, 15}},
+        {"Literal prefilter from offset", "beta \\d+", 9, []int{22, 30}},
+        {"No required literal", "\\d\\d\\d", 0, []int{27, 30}},
+        {"Anchored per line", "^gamma$", 0, []int{16, 21}},
+        {"Does not span lines", "1.beta", 0, nil},
+        {"No match", "delta", 0, nil},
+    }
+
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            rm, err := matcher.NewRegexMatcher(tc.pattern)
+            if err != nil {
+                t.Fatalf("Failed to create RegexMatcher: %v", err)
+            }
+            got := rm.FindIndex(buf, tc.from)
+            if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+                t.Errorf("Pattern: '%s' From: %d Expected: %v, Got: %v", tc.pattern, tc.from, tc.expected, got)
+            }
+        })
+    }
+}
@@ -0,0 +1,327 @@
+package matcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/grep-starter-go/internal/matcher"
+	"github.com/codecrafters-io/grep-starter-go/internal/search"
+)
+
+func searchString(t *testing.T, pattern, input string, opts search.Options) string {
+	t.Helper()
+	rm, err := matcher.NewRegexMatcher(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := search.New(rm, pattern, &out, opts).Search(strings.NewReader(input), "in"); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestSearchContext(t *testing.T) {
+	input := "a\nx1\nb\nc\nd\ne\nx2\nx3\nf\ng\n"
+	tests := []struct {
+		name     string
+		opts     search.Options
+		expected string
+	}{
+		{"After", search.Options{LineNumber: true, AfterContext: 1},
+			"2:x1\n3-b\n--\n7:x2\n8:x3\n9-f\n"},
+		{"Before", search.Options{LineNumber: true, BeforeContext: 2},
+			"1-a\n2:x1\n--\n5-d\n6-e\n7:x2\n8:x3\n"},
+		{"Adjacent groups merge", search.Options{LineNumber: true, BeforeContext: 2, AfterContext: 2},
+			"1-a\n2:x1\n3-b\n4-c\n5-d\n6-e\n7:x2\n8:x3\n9-f\n10-g\n"},
+		{"Max count keeps trailing context", search.Options{LineNumber: true, AfterContext: 2, MaxCount: 2},
+			"2:x1\n3-b\n4-c\n--\n7:x2\n8-x3\n9-f\n"},
+		{"Byte offsets", search.Options{ByteOffset: true, BeforeContext: 1},
+			"0-a\n2:x1\n--\n11-e\n13:x2\n16:x3\n"},
+		{"Files with matches ignores context", search.Options{FilesWithMatches: true, AfterContext: 3},
+			"in\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := searchString(t, `x\d`, input, tc.opts); got != tc.expected {
+				t.Errorf("Expected:\n%sGot:\n%s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSearchChunkedFile(t *testing.T) {
+	// Big enough to be split into several chunks of a mapped file.
+	var b strings.Builder
+	for i := 0; b.Len() < 20<<20; i++ {
+		if i%9973 == 0 || i%9973 == 1 {
+			fmt.Fprintf(&b, "hit %d\n", i)
+		} else {
+			fmt.Fprintf(&b, "line %d padding padding padding\n", i)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rm, err := matcher.NewRegexMatcher(`^hit \d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []search.Options{
+		{LineNumber: true},
+		{LineNumber: true, ByteOffset: true, BeforeContext: 2, AfterContext: 3},
+		{LineNumber: true, AfterContext: 1, MaxCount: 101},
+	} {
+		opts.Mmap = true
+		var want, got bytes.Buffer
+		if _, err := search.New(rm, "", &want, opts).SearchFiles(context.Background(), []string{path}, 1, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := search.New(rm, "", &got, opts).SearchFiles(context.Background(), []string{path}, 4, false); err != nil {
+			t.Fatal(err)
+		}
+		if want.Len() == 0 || got.String() != want.String() {
+			t.Errorf("%+v: chunked output differs from a single scan (%d vs %d bytes)", opts, got.Len(), want.Len())
+		}
+	}
+}
+
+func TestSearchMappedPerformance(t *testing.T) {
+	// Every line matches a pattern without a required literal, so each
+	// match is looked for from the end of the previous one.
+	var b strings.Builder
+	for i := 0; b.Len() < 3*search.MmapThreshold/2; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "digits.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rm, err := matcher.NewRegexMatcher(`\d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	start := time.Now()
+	if _, err := search.New(rm, "", &got, search.Options{Mmap: true}).SearchFile(path); err != nil {
+		t.Fatal(err)
+	}
+	duration := time.Since(start)
+
+	t.Logf("Mapped search time: %v", duration)
+	if got.String() != b.String() {
+		t.Errorf("mapped search printed %d bytes, want %d", got.Len(), b.Len())
+	}
+	if duration > 5*time.Second {
+		t.Errorf("Mapped search took too long: %v", duration)
+	}
+}
+
+func TestSearchJSON(t *testing.T) {
+	input := "x1 x2\nb\n\xffx3\n"
+	got := searchString(t, `x\d`, input, search.Options{Format: search.FormatJSON, Binary: search.BinaryText, AfterContext: 1})
+	expected := `{"type":"begin","data":{"path":{"text":"in"}}}
+{"type":"match","data":{"path":{"text":"in"},"line_number":1,"absolute_offset":0,"line":{"text":"x1 x2"},"submatches":[{"match":{"text":"x1"},"start":0,"end":2},{"match":{"text":"x2"},"start":3,"end":5}]}}
+{"type":"context","data":{"path":{"text":"in"},"line_number":2,"absolute_offset":6,"line":{"text":"b"},"submatches":[]}}
+{"type":"match","data":{"path":{"text":"in"},"line_number":3,"absolute_offset":8,"line":{"bytes":"/3gz"},"submatches":[{"match":{"text":"x3"},"start":1,"end":3}]}}
+{"type":"end","data":{"path":{"text":"in"},"binary":false,"stats":{"matched_lines":2,"matches":3}}}
+`
+	if got != expected {
+		t.Errorf("Expected:\n%sGot:\n%s", expected, got)
+	}
+
+	// Files without matches print no events; the summary counts them.
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for i, content := range []string{"x1 <&>\n", "none\n"} {
+		if err := os.WriteFile(paths[i], []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rm, err := matcher.NewRegexMatcher(`x\d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := search.New(rm, "", &out, search.Options{Format: search.FormatJSON, Mmap: true}).SearchFiles(context.Background(), paths, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 events, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[1], `"line":{"text":"x1 <&>"}`) {
+		t.Errorf("match event: %s", lines[1])
+	}
+	summary := `{"type":"summary","data":{"stats":{"searched":2,"matched":1,"errored":0,"matched_lines":1,"matches":1}}}`
+	if lines[3] != summary {
+		t.Errorf("Expected %s, got %s", summary, lines[3])
+	}
+}
+
+func TestSearchSARIF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(path, []byte("// TODO: é TODO\nok\npanic(err)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var rules []search.Rule
+	for _, r := range [][2]string{{"no-todo", `TODO`}, {`panic\(`, `panic\(`}} {
+		rm, err := matcher.NewRegexMatcher(r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, search.Rule{ID: r[0], Pattern: r[1], Matcher: rm})
+	}
+	rm, err := matcher.NewRegexMatcherPatterns([]string{`TODO`, `panic\(`}, matcher.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	opts := search.Options{Format: search.FormatSARIF, Rules: rules, AfterContext: 1}
+	if _, err := search.New(rm, "", &out, opts).SearchFiles(context.Background(), []string{path}, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn, EndColumn int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("%v in:\n%s", err, out.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 2 {
+		t.Fatalf("unexpected log:\n%s", out.String())
+	}
+	var got []string
+	for _, res := range log.Runs[0].Results {
+		loc := res.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation.URI != "file://"+filepath.ToSlash(path) {
+			t.Errorf("uri %q", loc.ArtifactLocation.URI)
+		}
+		got = append(got, fmt.Sprintf("%s %d:%d-%d", res.RuleID, loc.Region.StartLine, loc.Region.StartColumn, loc.Region.EndColumn))
+	}
+	expected := []string{"no-todo 1:4-8", "no-todo 1:12-16", `panic\( 3:1-7`}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestSearchTemplate(t *testing.T) {
+	pattern := `(?<key>\w+)=(\w+)`
+	rm, err := matcher.NewRegexMatcher(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "a=1 b=2\nplain\nc=3\n"
+	tests := []struct {
+		name     string
+		template string
+		opts     search.Options
+		expected string
+	}{
+		{"Per match", `{path}:{line}:{col}: {match}`, search.Options{},
+			"in:1:1: a=1\nin:1:5: b=2\nin:3:1: c=3\n"},
+		{"Groups and counts", `{<key>}\t{2}\t{offset}\t{count}/{matches}`, search.Options{},
+			"a\t1\t0\t1/1\nb\t2\t4\t1/2\nc\t3\t14\t2/3\n"},
+		{"Per line", `{line}\{{text}\}`, search.Options{},
+			"1{a=1 b=2}\n3{c=3}\n"},
+		{"Context", `{line}{if context}-{else}:{end}{text}`, search.Options{AfterContext: 1},
+			"1:a=1 b=2\n2-plain\n3:c=3\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := search.ParseTemplate(tc.template, rm.SubexpNames())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.opts.Format, tc.opts.Template = search.FormatTemplate, tmpl
+			var out bytes.Buffer
+			if _, err := search.New(rm, pattern, &out, tc.opts).Search(strings.NewReader(input), "in"); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tc.expected {
+				t.Errorf("Expected:\n%sGot:\n%s", tc.expected, got)
+			}
+		})
+	}
+
+	for _, bad := range []string{`{nope}`, `{3}`, `{<val>}`, `{if context}x`, `x{end}`, `{path`, `a}`, `\q`} {
+		if _, err := search.ParseTemplate(bad, rm.SubexpNames()); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestSearchHyperlink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a b.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link, err := search.ParseHyperlink("file://{host}{path}#L{line}C{col}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := matcher.NewRegexMatcher(`x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	url := "file://" + host + strings.ReplaceAll(filepath.ToSlash(path), " ", "%20") + "#L2C5"
+	osc := func(text string) string { return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\" }
+
+	tests := []struct {
+		name     string
+		opts     search.Options
+		expected string
+	}{
+		{"File name", search.Options{WithFilename: true, LineNumber: true}, osc(path) + ":2:two x\n"},
+		{"Line number", search.Options{LineNumber: true}, osc("2") + ":two x\n"},
+		{"Files with matches", search.Options{FilesWithMatches: true}, osc(path) + "\n"},
+		{"No prefix", search.Options{}, "two x\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Hyperlink = link
+			var out bytes.Buffer
+			if _, err := search.New(rm, "", &out, tc.opts).SearchFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	for _, bad := range []string{"file://{host}", "file://{path}{nope}", "file://{path"} {
+		if _, err := search.ParseHyperlink(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}